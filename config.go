@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// envString reads a string from the environment, falling back to the default if unset
+func envString(name string, fallback string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// envInt reads a positive integer from the environment, falling back to the default if unset
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		log.Fatalf("invalid positive integer %q for %s", value, name)
+	}
+	return parsed
+}
+
+// envDuration reads a duration such as "5s" from the environment, falling back to the default if unset
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid duration %q for %s: %s", value, name, err)
+	}
+	return duration
+}
+
+// envBool reads a boolean such as "true" from the environment, falling back to the default if unset
+func envBool(name string, fallback bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("invalid boolean %q for %s: %s", value, name, err)
+	}
+	return parsed
+}
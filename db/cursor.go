@@ -0,0 +1,52 @@
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Error definitions
+var ErrorInvalidCursor error = errors.New("provided cursor is not valid")
+var ErrorInvalidPageSize error = errors.New("page size must be between 0 and 100")
+
+// DefaultPageSize is the number of edges returned in a page of a connection if not specified
+const DefaultPageSize = 20
+
+// MaxPageSize is the maximum number of edges returned in a single page of a connection
+const MaxPageSize = 100
+
+// EncodeCursor encodes the row ID of a connection's edge as an opaque cursor. The cursor is
+// prefixed with the connection's name so cursors cannot be mixed up between connections.
+func EncodeCursor(connection string, id int64) string {
+	return base64.StdEncoding.EncodeToString([]byte(connection + ":" + strconv.FormatInt(id, 10)))
+}
+
+// DecodeCursor decodes a cursor of the given connection into the row ID of its edge
+func DecodeCursor(connection string, cursor string) (int64, error) {
+	data, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrorInvalidCursor
+	}
+
+	prefix := connection + ":"
+	if !strings.HasPrefix(string(data), prefix) {
+		return 0, ErrorInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(string(data), prefix), 10, 64)
+	if err != nil {
+		return 0, ErrorInvalidCursor
+	}
+
+	return id, nil
+}
+
+// validatePageSize checks that the requested number of edges can be returned in a single page
+func validatePageSize(first int) error {
+	if first < 0 || first > MaxPageSize {
+		return ErrorInvalidPageSize
+	}
+	return nil
+}
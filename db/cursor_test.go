@@ -0,0 +1,45 @@
+package db
+
+import "testing"
+
+func TestDecodeCursor(t *testing.T) {
+	tests := []struct {
+		description string
+		input       string
+		want        int64
+		wantErr     error
+	}{
+		{
+			description: "should decode cursor of the connection",
+			input:       EncodeCursor("history", 42),
+			want:        42,
+		},
+		{
+			description: "should reject cursor of another connection",
+			input:       EncodeCursor("results", 42),
+			wantErr:     ErrorInvalidCursor,
+		},
+		{
+			description: "should reject cursor that is not base64",
+			input:       "not a cursor!",
+			wantErr:     ErrorInvalidCursor,
+		},
+		{
+			description: "should reject cursor without an ID",
+			input:       EncodeCursor("history", 0)[:8],
+			wantErr:     ErrorInvalidCursor,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			id, err := DecodeCursor("history", test.input)
+			if err != test.wantErr {
+				t.Fatalf("got error '%v', want '%v'", err, test.wantErr)
+			}
+			if id != test.want {
+				t.Errorf("got %d, want %d", id, test.want)
+			}
+		})
+	}
+}
@@ -3,7 +3,10 @@ package db
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"net"
+	"strings"
+	"time"
 
 	"github.com/grantsavage/ip-lookup-api/graph/model"
 	_ "github.com/mattn/go-sqlite3"
@@ -11,6 +14,16 @@ import (
 
 // Error definitions
 var ErrorNotFound error = errors.New("could not find a result for the given IP")
+var ErrorBatchTooLarge error = errors.New("too many IPs requested at once")
+
+// MaxBatchSize is the maximum number of IPs whose results can be requested at once
+const MaxBatchSize = 1000
+
+// dbTime converts a time to UTC, which every timestamp is stored in. SQLite compares timestamps
+// as text, so times must be converted before they are stored or compared against stored ones.
+func dbTime(t time.Time) time.Time {
+	return t.UTC()
+}
 
 // Connect opens the connection to the database
 func Connect(datastore string) (*sql.DB, error) {
@@ -19,71 +32,174 @@ func Connect(datastore string) (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	// SQLite only supports a single writer, so serialize access from concurrent workers
+	db.SetMaxOpenConns(1)
+
 	return db, nil
 }
 
-// SetupDatabase creates the required tables for the application
-func SetupDatabase(db *sql.DB) error {
+// GetIPLookupResults gets the lookup results of an IP, one per zone
+func GetIPLookupResults(db *sql.DB, ip net.IP) ([]*model.IPLookupResult, error) {
 	query := `
-	CREATE TABLE IF NOT EXISTS address_results 
-	(
-		uuid TEXT UNIQUE, 
-		response_code TEXT, 
-		ip_address TEXT UNIQUE PRIMARY KEY,
-		created_at TEXT, 
-		updated_at TEXT
-	)
+	SELECT uuid, ip_address, zone, status, response_code, error_class, reason, created_at, updated_at 
+	FROM address_results
+	WHERE ip_address = $1
+	ORDER BY zone
 	`
-	sqlStatement, err := db.Prepare(query)
+	rows, err := db.Query(query, ip.String())
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	_, err = sqlStatement.Exec()
-	return err
+	results, err := scanIPLookupResults(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(results) == 0 {
+		return nil, ErrorNotFound
+	}
+
+	return results, nil
 }
 
-// GeIPLookupResult gets an IP lookup result
-func GetIPLookupResult(db *sql.DB, ip net.IP) (*model.IPLookupResult, error) {
-	query := `
-	SELECT uuid, ip_address, response_code, created_at, updated_at 
+// GetIPLookupResultsBatch gets the lookup results of many IPs with a single query. The results are
+// grouped by IP, one per zone, and IPs without any result are left out.
+func GetIPLookupResultsBatch(db *sql.DB, ips []net.IP) (map[string][]*model.IPLookupResult, error) {
+	if len(ips) > MaxBatchSize {
+		return nil, ErrorBatchTooLarge
+	}
+
+	resultsByIP := map[string][]*model.IPLookupResult{}
+	if len(ips) == 0 {
+		return resultsByIP, nil
+	}
+
+	placeholders := []string{}
+	args := []interface{}{}
+	for i, ip := range ips {
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i+1))
+		args = append(args, ip.String())
+	}
+
+	query := fmt.Sprintf(`
+	SELECT uuid, ip_address, zone, status, response_code, error_class, reason, created_at, updated_at
 	FROM address_results
-	WHERE ip_address = $1
-	LIMIT 1
-	`
-	rows, err := db.Query(query, ip.String())
+	WHERE ip_address IN (%s)
+	ORDER BY ip_address, zone
+	`, strings.Join(placeholders, ", "))
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	// Normalize returned row data intro IPLookupResult
-	result := &model.IPLookupResult{}
+	results, err := scanIPLookupResults(rows)
+	if err != nil {
+		return nil, err
+	}
 
-	if !rows.Next() {
-		return nil, ErrorNotFound
+	for _, result := range results {
+		ip := result.IPAddress.String()
+		resultsByIP[ip] = append(resultsByIP[ip], result)
 	}
 
-	err = rows.Scan(&result.UUID, &result.IPAddress, &result.ResponseCode, &result.CreatedAt, &result.UpdatedAt)
+	return resultsByIP, nil
+}
+
+// scanIPLookupResults normalizes returned row data into IPLookupResults
+func scanIPLookupResults(rows *sql.Rows) ([]*model.IPLookupResult, error) {
+	results := []*model.IPLookupResult{}
+	for rows.Next() {
+		var ipAddress string
+		result := &model.IPLookupResult{}
+		err := rows.Scan(
+			&result.UUID,
+			&ipAddress,
+			&result.Zone,
+			&result.Status,
+			&result.ResponseCode,
+			&result.ErrorClass,
+			&result.Reason,
+			&result.CreatedAt,
+			&result.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.IPAddress = net.ParseIP(ipAddress)
+		results = append(results, result)
+	}
 
-	return result, err
+	return results, rows.Err()
 }
 
-// UpsertIPLookupResult upserts an IPLookupResult
+// UpsertIPLookupResult upserts an IPLookupResult, records a listing event if the IP was listed,
+// delisted or its listing changed, and records the check in the lookup history
 func UpsertIPLookupResult(db *sql.DB, result model.IPLookupResult) error {
+	// The result, its events and its history are stored together so none of them misses a check
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	/* This will first try to insert a result, but if a conflict occurs, this is most likely
-	because a record for the IP already exists, so instead we update the response_code and
-	updated_at time */
+	because a record for the IP and zone already exists, so instead we update the status,
+	response_code, error_class, reason and updated_at time */
 	query := `
-	INSERT INTO address_results (uuid, ip_address, response_code, created_at, updated_at)
-	VALUES ($1, $2, $3, $4, $5)
-	ON CONFLICT(ip_address) DO UPDATE SET response_code = $3, updated_at = $5
-	WHERE ip_address = $2;
+	INSERT INTO address_results (uuid, ip_address, zone, status, response_code, error_class, reason, created_at, updated_at, ip_bytes)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	ON CONFLICT(ip_address, zone) DO UPDATE SET status = $4, response_code = $5, error_class = $6, reason = $7, updated_at = $9
+	WHERE address_results.ip_address = $2 AND address_results.zone = $3;
 	`
-	upsertStatement, err := db.Prepare(query)
+	upsertStatement, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer upsertStatement.Close()
+
+	_, err = upsertStatement.Exec(
+		result.UUID,
+		result.IPAddress.String(),
+		result.Zone,
+		result.Status,
+		result.ResponseCode,
+		result.ErrorClass,
+		result.Reason,
+		dbTime(result.CreatedAt),
+		dbTime(result.UpdatedAt),
+		ipBytes(result.IPAddress),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Compare with the history before this check is added to it
+	err = recordListingEvent(tx, result)
+	if err != nil {
+		return err
+	}
+
+	// Unlike the result, the history is never overwritten
+	historyQuery := `
+	INSERT INTO lookup_history (ip_address, zone, status, response_code, error_class, checked_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err = tx.Exec(
+		historyQuery,
+		result.IPAddress.String(),
+		result.Zone,
+		result.Status,
+		result.ResponseCode,
+		result.ErrorClass,
+		dbTime(result.UpdatedAt),
+	)
 	if err != nil {
 		return err
 	}
 
-	_, err = upsertStatement.Exec(result.UUID, result.IPAddress, result.ResponseCode, result.CreatedAt, result.UpdatedAt)
-	return err
+	return tx.Commit()
 }
@@ -12,68 +12,36 @@ import (
 	uuid "github.com/satori/go.uuid"
 )
 
-func TestSetupDatbase(t *testing.T) {
+func TestGetIPLookupResults(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
 	}
 	defer db.Close()
 
-	t.Run("should setup address_results table", func(t *testing.T) {
-		mock.ExpectPrepare("CREATE TABLE IF NOT EXISTS address_results(.+)").WillReturnError(nil)
-		mock.ExpectExec("CREATE TABLE IF NOT EXISTS address_results(.+)").WillReturnResult(sqlmock.NewResult(0, 0))
-
-		err = SetupDatabase(db)
-		if err != nil {
-			t.Fatalf("error: '%s'", err)
-		}
-
-		err = mock.ExpectationsWereMet()
-		if err != nil {
-			t.Errorf("expectations were not met: '%s'", err)
-		}
-	})
-
-	t.Run("should return error on SQL execution error", func(t *testing.T) {
-		executionError := errors.New("sql error")
-
-		mock.ExpectPrepare("CREATE TABLE IF NOT EXISTS address_results(.+)").WillReturnError(executionError)
-
-		err = SetupDatabase(db)
-		if err != executionError {
-			t.Errorf("got error '%s', wanted '%s'", err, executionError)
-		}
-
-		err = mock.ExpectationsWereMet()
-		if err != nil {
-			t.Errorf("expectations were not met: '%s'", err)
-		}
-	})
-}
-
-func TestGetIPLookupResult(t *testing.T) {
-	db, mock, err := sqlmock.New()
-	if err != nil {
-		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
-	}
-	defer db.Close()
-
-	t.Run("should return lookup result", func(t *testing.T) {
+	t.Run("should return lookup results", func(t *testing.T) {
 		ip := net.ParseIP("1.2.3.4")
+		responseCode := "127.0.0.4"
 		result := &model.IPLookupResult{
 			UUID:         uuid.NewV4().String(),
-			IPAddress:    ip.String(),
-			ResponseCode: "127.0.0.4",
-			CreatedAt:    time.Now().Format(time.RFC3339),
-			UpdatedAt:    time.Now().Format(time.RFC3339),
+			IPAddress:    ip,
+			Zone:         "spamhaus-zen",
+			Status:       model.LookupStatusListed,
+			ResponseCode: &responseCode,
+			CreatedAt:    time.Now().UTC().Truncate(time.Second),
+			UpdatedAt:    time.Now().UTC().Truncate(time.Second),
 		}
 
 		rows := sqlmock.
-			NewRows([]string{"uuid", "ip_address", "response_code", "created_at", "updated_at"}).
+			NewRows([]string{"uuid", "ip_address", "zone", "status", "response_code", "error_class", "reason", "created_at", "updated_at"}).
 			AddRow(
 				result.UUID,
-				result.IPAddress,
+				result.IPAddress.String(),
+				result.Zone,
+				result.Status,
 				result.ResponseCode,
+				result.ErrorClass,
+				result.Reason,
 				result.CreatedAt,
 				result.UpdatedAt,
 			)
@@ -82,7 +50,7 @@ func TestGetIPLookupResult(t *testing.T) {
 			WithArgs(ip.String()).
 			WillReturnRows(rows)
 
-		lookupResult, err := GetIPLookupResult(db, ip)
+		lookupResults, err := GetIPLookupResults(db, ip)
 		if err != nil {
 			t.Fatalf("error: '%s'", err)
 		}
@@ -92,8 +60,9 @@ func TestGetIPLookupResult(t *testing.T) {
 			t.Errorf("expectations were not met: '%s'", err)
 		}
 
-		if !reflect.DeepEqual(result, lookupResult) {
-			t.Errorf("got '%q', want '%q", lookupResult, result)
+		want := []*model.IPLookupResult{result}
+		if !reflect.DeepEqual(want, lookupResults) {
+			t.Errorf("got '%v', want '%v'", lookupResults, want)
 		}
 	})
 
@@ -101,13 +70,13 @@ func TestGetIPLookupResult(t *testing.T) {
 		ip := net.ParseIP("5.6.7.8")
 
 		rows := sqlmock.
-			NewRows([]string{"uuid", "ip_address", "response_code", "created_at", "updated_at"})
+			NewRows([]string{"uuid", "ip_address", "zone", "status", "response_code", "error_class", "reason", "created_at", "updated_at"})
 		mock.
 			ExpectQuery(`SELECT(.+)FROM address_results(.+)`).
 			WithArgs(ip.String()).
 			WillReturnRows(rows)
 
-		_, err := GetIPLookupResult(db, ip)
+		_, err := GetIPLookupResults(db, ip)
 		if err == nil {
 			t.Error("error not returned")
 		}
@@ -131,7 +100,79 @@ func TestGetIPLookupResult(t *testing.T) {
 			WithArgs(ip.String()).
 			WillReturnError(queryError)
 
-		_, err := GetIPLookupResult(db, ip)
+		_, err := GetIPLookupResults(db, ip)
+		if err != queryError {
+			t.Errorf("got error '%s', wanted '%s'", err, queryError)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestGetIPLookupResultsBatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	columns := []string{"uuid", "ip_address", "zone", "status", "response_code", "error_class", "reason", "created_at", "updated_at"}
+
+	t.Run("should return lookup results grouped by IP with a single query", func(t *testing.T) {
+		now := time.Now().UTC().Truncate(time.Second)
+		rows := sqlmock.NewRows(columns).
+			AddRow("uuid-1", "1.2.3.4", "spamcop", model.LookupStatusNotListed, nil, nil, nil, now, now).
+			AddRow("uuid-2", "1.2.3.4", "spamhaus-zen", model.LookupStatusNotListed, nil, nil, nil, now, now).
+			AddRow("uuid-3", "2001:db8::1", "spamhaus-zen", model.LookupStatusNotListed, nil, nil, nil, now, now)
+		mock.
+			ExpectQuery(`SELECT(.+)FROM address_results(.+)WHERE ip_address IN \(\$1, \$2, \$3\)`).
+			WithArgs("1.2.3.4", "2001:db8::1", "5.6.7.8").
+			WillReturnRows(rows)
+
+		ips := []net.IP{net.ParseIP("1.2.3.4"), net.ParseIP("2001:0db8::0001"), net.ParseIP("5.6.7.8")}
+		resultsByIP, err := GetIPLookupResultsBatch(db, ips)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		if len(resultsByIP) != 2 || len(resultsByIP["1.2.3.4"]) != 2 || len(resultsByIP["2001:db8::1"]) != 1 {
+			t.Errorf("got '%v', want two results for 1.2.3.4 and one for 2001:db8::1", resultsByIP)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should not query without IPs", func(t *testing.T) {
+		resultsByIP, err := GetIPLookupResultsBatch(db, []net.IP{})
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+		if len(resultsByIP) != 0 {
+			t.Errorf("got '%v', want no results", resultsByIP)
+		}
+	})
+
+	t.Run("should return error if too many IPs are requested", func(t *testing.T) {
+		ips := make([]net.IP, MaxBatchSize+1)
+		_, err := GetIPLookupResultsBatch(db, ips)
+		if err != ErrorBatchTooLarge {
+			t.Errorf("got error '%s', wanted '%s'", err, ErrorBatchTooLarge)
+		}
+	})
+
+	t.Run("should return error if query fails", func(t *testing.T) {
+		queryError := errors.New("unable to query")
+		mock.
+			ExpectQuery(`SELECT(.+)FROM address_results(.+)`).
+			WillReturnError(queryError)
+
+		_, err := GetIPLookupResultsBatch(db, []net.IP{net.ParseIP("1.2.3.4")})
 		if err != queryError {
 			t.Errorf("got error '%s', wanted '%s'", err, queryError)
 		}
@@ -152,14 +193,18 @@ func TestUpsertIPLookupResult(t *testing.T) {
 
 	t.Run("should upsert result", func(t *testing.T) {
 		ip := net.ParseIP("1.2.3.4")
+		responseCode := "127.0.0.4"
 		result := model.IPLookupResult{
 			UUID:         uuid.NewV4().String(),
-			IPAddress:    ip.String(),
-			ResponseCode: "127.0.0.4",
-			CreatedAt:    time.Now().Format(time.RFC3339),
-			UpdatedAt:    time.Now().Format(time.RFC3339),
+			IPAddress:    ip,
+			Zone:         "spamhaus-zen",
+			Status:       model.LookupStatusListed,
+			ResponseCode: &responseCode,
+			CreatedAt:    time.Now().UTC().Truncate(time.Second),
+			UpdatedAt:    time.Now().UTC().Truncate(time.Second),
 		}
 
+		mock.ExpectBegin()
 		mock.
 			ExpectPrepare(`INSERT INTO address_results(.+)ON CONFLICT(.+)`).
 			WillReturnError(nil)
@@ -167,11 +212,127 @@ func TestUpsertIPLookupResult(t *testing.T) {
 			ExpectExec(`INSERT INTO address_results(.+)ON CONFLICT(.+)`).
 			WithArgs(
 				result.UUID,
-				result.IPAddress,
+				result.IPAddress.String(),
+				result.Zone,
+				result.Status,
 				result.ResponseCode,
+				result.ErrorClass,
+				result.Reason,
 				result.CreatedAt,
 				result.UpdatedAt,
+				[]byte(ip.To16()),
 			).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.
+			ExpectQuery(`SELECT status, response_code FROM lookup_history(.+)`).
+			WithArgs(result.IPAddress.String(), result.Zone, model.LookupStatusListed, model.LookupStatusNotListed).
+			WillReturnRows(sqlmock.NewRows([]string{"status", "response_code"}))
+		mock.
+			ExpectExec(`INSERT INTO listing_events(.+)`).
+			WithArgs(result.IPAddress.String(), result.Zone, model.ListingEventTypeListed, nil, result.ResponseCode, result.UpdatedAt).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.
+			ExpectExec(`INSERT INTO lookup_history(.+)`).
+			WithArgs(
+				result.IPAddress.String(),
+				result.Zone,
+				result.Status,
+				result.ResponseCode,
+				result.ErrorClass,
+				result.UpdatedAt,
+			).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err = UpsertIPLookupResult(db, result)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should not record event for the same response codes in another order", func(t *testing.T) {
+		ip := net.ParseIP("1.2.3.4")
+		responseCode := "127.0.0.4,127.0.0.10"
+		result := model.IPLookupResult{
+			UUID:         uuid.NewV4().String(),
+			IPAddress:    ip,
+			Zone:         "spamhaus-zen",
+			Status:       model.LookupStatusListed,
+			ResponseCode: &responseCode,
+			CreatedAt:    time.Now().UTC().Truncate(time.Second),
+			UpdatedAt:    time.Now().UTC().Truncate(time.Second),
+		}
+
+		mock.ExpectBegin()
+		mock.
+			ExpectPrepare(`INSERT INTO address_results(.+)ON CONFLICT(.+)`).
+			WillReturnError(nil)
+		mock.
+			ExpectExec(`INSERT INTO address_results(.+)ON CONFLICT(.+)`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.
+			ExpectQuery(`SELECT status, response_code FROM lookup_history(.+)`).
+			WithArgs(result.IPAddress.String(), result.Zone, model.LookupStatusListed, model.LookupStatusNotListed).
+			WillReturnRows(sqlmock.NewRows([]string{"status", "response_code"}).AddRow(model.LookupStatusListed, "127.0.0.10,127.0.0.4"))
+		mock.
+			ExpectExec(`INSERT INTO lookup_history(.+)`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		err = UpsertIPLookupResult(db, result)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should upsert failed result", func(t *testing.T) {
+		ip := net.ParseIP("1.2.3.4")
+		errorClass := model.DNSErrorClassServfail
+		result := model.IPLookupResult{
+			UUID:       uuid.NewV4().String(),
+			IPAddress:  ip,
+			Zone:       "spamhaus-zen",
+			Status:     model.LookupStatusError,
+			ErrorClass: &errorClass,
+			CreatedAt:  time.Now().UTC().Truncate(time.Second),
+			UpdatedAt:  time.Now().UTC().Truncate(time.Second),
+		}
+
+		mock.ExpectBegin()
+		mock.
+			ExpectPrepare(`INSERT INTO address_results(.+)ON CONFLICT(.+)`).
+			WillReturnError(nil)
+		mock.
+			ExpectExec(`INSERT INTO address_results(.+)ON CONFLICT(.+)`).
+			WithArgs(
+				result.UUID,
+				result.IPAddress.String(),
+				result.Zone,
+				"ERROR",
+				nil,
+				"SERVFAIL",
+				nil,
+				result.CreatedAt,
+				result.UpdatedAt,
+				[]byte(ip.To16()),
+			).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.
+			ExpectQuery(`SELECT status, response_code FROM lookup_history(.+)`).
+			WithArgs(result.IPAddress.String(), result.Zone, model.LookupStatusListed, model.LookupStatusNotListed).
+			WillReturnRows(sqlmock.NewRows([]string{"status", "response_code"}))
+		mock.
+			ExpectExec(`INSERT INTO lookup_history(.+)`).
+			WithArgs(result.IPAddress.String(), result.Zone, "ERROR", nil, "SERVFAIL", result.UpdatedAt).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
 
 		err = UpsertIPLookupResult(db, result)
 		if err != nil {
@@ -186,18 +347,23 @@ func TestUpsertIPLookupResult(t *testing.T) {
 
 	t.Run("should return error when SQL exception occurs", func(t *testing.T) {
 		ip := net.ParseIP("1.2.3.4")
+		responseCode := "127.0.0.4"
 		result := model.IPLookupResult{
 			UUID:         uuid.NewV4().String(),
-			IPAddress:    ip.String(),
-			ResponseCode: "127.0.0.4",
-			CreatedAt:    time.Now().Format(time.RFC3339),
-			UpdatedAt:    time.Now().Format(time.RFC3339),
+			IPAddress:    ip,
+			Zone:         "spamhaus-zen",
+			Status:       model.LookupStatusListed,
+			ResponseCode: &responseCode,
+			CreatedAt:    time.Now().UTC().Truncate(time.Second),
+			UpdatedAt:    time.Now().UTC().Truncate(time.Second),
 		}
 
 		executionError := errors.New("sql error")
+		mock.ExpectBegin()
 		mock.
 			ExpectPrepare(`INSERT INTO address_results(.+)ON CONFLICT(.+)`).
 			WillReturnError(executionError)
+		mock.ExpectRollback()
 
 		err = UpsertIPLookupResult(db, result)
 		if err != executionError {
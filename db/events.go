@@ -0,0 +1,122 @@
+package db
+
+import (
+	"database/sql"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+// ResponseCodeSeparator separates the response codes stored for an IP that a zone lists for
+// several reasons, e.g. 127.0.0.4,127.0.0.10
+const ResponseCodeSeparator = ","
+
+// DetectListingEvent compares a lookup result with the previous conclusive result of the same
+// IP and zone and returns the type of the transition, if any. A previous status of nil means
+// the IP was never conclusively checked against the zone. Failed lookups say nothing about
+// whether an IP is listed, so they never cause an event.
+func DetectListingEvent(previousStatus *model.LookupStatus, previousCode *string, result model.IPLookupResult) (model.ListingEventType, bool) {
+	wasListed := previousStatus != nil && *previousStatus == model.LookupStatusListed
+
+	switch result.Status {
+	case model.LookupStatusListed:
+		if !wasListed {
+			return model.ListingEventTypeListed, true
+		}
+		if previousCode == nil || result.ResponseCode == nil || !sameResponseCodes(*previousCode, *result.ResponseCode) {
+			return model.ListingEventTypeCodeChanged, true
+		}
+	case model.LookupStatusNotListed:
+		if wasListed {
+			return model.ListingEventTypeDelisted, true
+		}
+	}
+
+	return "", false
+}
+
+// sameResponseCodes reports whether two stored results hold the same set of response codes,
+// regardless of their order
+func sameResponseCodes(a string, b string) bool {
+	aCodes := strings.Split(a, ResponseCodeSeparator)
+	bCodes := strings.Split(b, ResponseCodeSeparator)
+	sort.Strings(aCodes)
+	sort.Strings(bCodes)
+	return reflect.DeepEqual(aCodes, bCodes)
+}
+
+// recordListingEvent stores an event if the result changes whether or how the IP is listed by the
+// zone. It must be called before the result is added to the lookup history.
+func recordListingEvent(tx *sql.Tx, result model.IPLookupResult) error {
+	// The history keeps the last conclusive result even if later lookups failed
+	var previousStatus *model.LookupStatus
+	var previousCode *string
+	query := `
+	SELECT status, response_code
+	FROM lookup_history
+	WHERE ip_address = $1 AND zone = $2 AND status IN ($3, $4)
+	ORDER BY id DESC
+	LIMIT 1
+	`
+	err := tx.QueryRow(query, result.IPAddress.String(), result.Zone, model.LookupStatusListed, model.LookupStatusNotListed).
+		Scan(&previousStatus, &previousCode)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	eventType, changed := DetectListingEvent(previousStatus, previousCode, result)
+	if !changed {
+		return nil
+	}
+
+	eventQuery := `
+	INSERT INTO listing_events (ip_address, zone, type, previous_response_code, response_code, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err = tx.Exec(eventQuery, result.IPAddress.String(), result.Zone, eventType, previousCode, result.ResponseCode, dbTime(result.UpdatedAt))
+	return err
+}
+
+// GetListingEvents gets the listing events that occurred at or after the given time, oldest first
+func GetListingEvents(db *sql.DB, since time.Time) ([]*model.ListingEvent, error) {
+	query := `
+	SELECT id, ip_address, zone, type, previous_response_code, response_code, created_at
+	FROM listing_events
+	WHERE created_at >= $1
+	ORDER BY id
+	`
+	rows, err := db.Query(query, dbTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []*model.ListingEvent{}
+	for rows.Next() {
+		var id int64
+		var ipAddress string
+		event := &model.ListingEvent{}
+		err = rows.Scan(
+			&id,
+			&ipAddress,
+			&event.Zone,
+			&event.Type,
+			&event.PreviousResponseCode,
+			&event.ResponseCode,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		event.ID = strconv.FormatInt(id, 10)
+		event.IPAddress = net.ParseIP(ipAddress)
+		events = append(events, event)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestDetectListingEvent(t *testing.T) {
+	listed := model.LookupStatusListed
+	notListed := model.LookupStatusNotListed
+	sbl := "127.0.0.2"
+	xbl := "127.0.0.4"
+	xblAndPBL := "127.0.0.4,127.0.0.10"
+	pblAndXBL := "127.0.0.10,127.0.0.4"
+
+	tests := []struct {
+		description    string
+		previousStatus *model.LookupStatus
+		previousCode   *string
+		result         model.IPLookupResult
+		want           model.ListingEventType
+		wantChanged    bool
+	}{
+		{
+			description:    "should detect clean IP becoming listed",
+			previousStatus: &notListed,
+			result:         model.IPLookupResult{Status: model.LookupStatusListed, ResponseCode: &sbl},
+			want:           model.ListingEventTypeListed,
+			wantChanged:    true,
+		},
+		{
+			description: "should detect first check of IP being listed",
+			result:      model.IPLookupResult{Status: model.LookupStatusListed, ResponseCode: &sbl},
+			want:        model.ListingEventTypeListed,
+			wantChanged: true,
+		},
+		{
+			description:    "should detect listed IP becoming clean",
+			previousStatus: &listed,
+			previousCode:   &sbl,
+			result:         model.IPLookupResult{Status: model.LookupStatusNotListed},
+			want:           model.ListingEventTypeDelisted,
+			wantChanged:    true,
+		},
+		{
+			description:    "should ignore the order of several response codes",
+			previousStatus: &listed,
+			previousCode:   &xblAndPBL,
+			result:         model.IPLookupResult{Status: model.LookupStatusListed, ResponseCode: &pblAndXBL},
+			wantChanged:    false,
+		},
+		{
+			description:    "should detect response code added to others",
+			previousStatus: &listed,
+			previousCode:   &xbl,
+			result:         model.IPLookupResult{Status: model.LookupStatusListed, ResponseCode: &xblAndPBL},
+			want:           model.ListingEventTypeCodeChanged,
+			wantChanged:    true,
+		},
+		{
+			description:    "should detect changed response code",
+			previousStatus: &listed,
+			previousCode:   &sbl,
+			result:         model.IPLookupResult{Status: model.LookupStatusListed, ResponseCode: &xbl},
+			want:           model.ListingEventTypeCodeChanged,
+			wantChanged:    true,
+		},
+		{
+			description:    "should ignore unchanged listing",
+			previousStatus: &listed,
+			previousCode:   &sbl,
+			result:         model.IPLookupResult{Status: model.LookupStatusListed, ResponseCode: &sbl},
+		},
+		{
+			description:    "should ignore clean IP staying clean",
+			previousStatus: &notListed,
+			result:         model.IPLookupResult{Status: model.LookupStatusNotListed},
+		},
+		{
+			description: "should ignore first check of clean IP",
+			result:      model.IPLookupResult{Status: model.LookupStatusNotListed},
+		},
+		{
+			description:    "should ignore failed lookup of listed IP",
+			previousStatus: &listed,
+			previousCode:   &sbl,
+			result:         model.IPLookupResult{Status: model.LookupStatusError},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, changed := DetectListingEvent(test.previousStatus, test.previousCode, test.result)
+			if got != test.want || changed != test.wantChanged {
+				t.Errorf("got '%s' (changed %t), want '%s' (changed %t)", got, changed, test.want, test.wantChanged)
+			}
+		})
+	}
+}
+
+func TestGetListingEvents(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	since := time.Date(2021, 3, 1, 7, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	t.Run("should return events since the given time", func(t *testing.T) {
+		responseCode := "127.0.0.4"
+		createdAt := time.Date(2021, 3, 1, 13, 0, 0, 0, time.UTC)
+		rows := sqlmock.
+			NewRows([]string{"id", "ip_address", "zone", "type", "previous_response_code", "response_code", "created_at"}).
+			AddRow(7, "1.2.3.4", "spamhaus-zen", model.ListingEventTypeListed, nil, responseCode, createdAt)
+		mock.
+			ExpectQuery(`SELECT(.+)FROM listing_events(.+)`).
+			WithArgs(time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)).
+			WillReturnRows(rows)
+
+		events, err := GetListingEvents(db, since)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		want := []*model.ListingEvent{
+			{
+				ID:           "7",
+				IPAddress:    net.ParseIP("1.2.3.4"),
+				Zone:         "spamhaus-zen",
+				Type:         model.ListingEventTypeListed,
+				ResponseCode: &responseCode,
+				CreatedAt:    createdAt,
+			},
+		}
+		if !reflect.DeepEqual(events, want) {
+			t.Errorf("got '%v', want '%v'", events, want)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should return error if query fails", func(t *testing.T) {
+		queryError := errors.New("unable to query")
+		mock.
+			ExpectQuery(`SELECT(.+)FROM listing_events(.+)`).
+			WillReturnError(queryError)
+
+		_, err := GetListingEvents(db, since)
+		if err != queryError {
+			t.Errorf("got error '%s', wanted '%s'", err, queryError)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
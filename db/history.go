@@ -0,0 +1,72 @@
+package db
+
+import (
+	"database/sql"
+	"math"
+	"net"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+// historyConnection names the cursors of the lookup history connection
+const historyConnection = "history"
+
+// GetLookupHistory gets a page of the checks of an IP against a zone, most recent first.
+// The page starts after the given cursor, if any.
+func GetLookupHistory(db *sql.DB, ip net.IP, zone string, first int, after *string) (*model.LookupHistoryConnection, error) {
+	err := validatePageSize(first)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start from the most recent check unless a cursor is given
+	var afterID int64 = math.MaxInt64
+	if after != nil {
+		afterID, err = DecodeCursor(historyConnection, *after)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Fetch one more check than requested to find out whether there is a next page
+	query := `
+	SELECT id, zone, status, response_code, error_class, checked_at
+	FROM lookup_history
+	WHERE ip_address = $1 AND zone = $2 AND id < $3
+	ORDER BY id DESC
+	LIMIT $4
+	`
+	rows, err := db.Query(query, ip.String(), zone, afterID, first+1)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	connection := &model.LookupHistoryConnection{
+		Edges:    []*model.LookupHistoryEdge{},
+		PageInfo: &model.PageInfo{},
+	}
+	for rows.Next() {
+		if len(connection.Edges) == first {
+			connection.PageInfo.HasNextPage = true
+			break
+		}
+
+		var id int64
+		entry := &model.LookupHistoryEntry{}
+		err = rows.Scan(&id, &entry.Zone, &entry.Status, &entry.ResponseCode, &entry.ErrorClass, &entry.CheckedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		cursor := EncodeCursor(historyConnection, id)
+		connection.Edges = append(connection.Edges, &model.LookupHistoryEdge{Cursor: cursor, Node: entry})
+		connection.PageInfo.EndCursor = &cursor
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return connection, nil
+}
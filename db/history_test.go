@@ -0,0 +1,103 @@
+package db
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestGetLookupHistory(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	columns := []string{"id", "zone", "status", "response_code", "error_class", "checked_at"}
+
+	t.Run("should return first page with next page", func(t *testing.T) {
+		rows := sqlmock.NewRows(columns).
+			AddRow(3, "spamhaus-zen", model.LookupStatusNotListed, nil, nil, time.Date(2021, 3, 3, 0, 0, 0, 0, time.UTC)).
+			AddRow(2, "spamhaus-zen", model.LookupStatusListed, "127.0.0.4", nil, time.Date(2021, 3, 2, 0, 0, 0, 0, time.UTC)).
+			AddRow(1, "spamhaus-zen", model.LookupStatusListed, "127.0.0.4", nil, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))
+		mock.
+			ExpectQuery(`SELECT(.+)FROM lookup_history(.+)`).
+			WithArgs("1.2.3.4", "spamhaus-zen", int64(1<<63-1), 3).
+			WillReturnRows(rows)
+
+		history, err := GetLookupHistory(db, net.ParseIP("1.2.3.4"), "spamhaus-zen", 2, nil)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		if len(history.Edges) != 2 {
+			t.Fatalf("got %d edges, want 2", len(history.Edges))
+		}
+		if history.Edges[0].Node.Status != model.LookupStatusNotListed || history.Edges[1].Node.Status != model.LookupStatusListed {
+			t.Errorf("got edges %v, want most recent check first", history.Edges)
+		}
+		if !history.PageInfo.HasNextPage {
+			t.Error("got no next page, want next page")
+		}
+		if *history.PageInfo.EndCursor != EncodeCursor(historyConnection, 2) {
+			t.Errorf("got end cursor '%s', want cursor of second edge", *history.PageInfo.EndCursor)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should return page after cursor", func(t *testing.T) {
+		after := EncodeCursor(historyConnection, 2)
+		rows := sqlmock.NewRows(columns).
+			AddRow(1, "spamhaus-zen", model.LookupStatusListed, "127.0.0.4", nil, time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC))
+		mock.
+			ExpectQuery(`SELECT(.+)FROM lookup_history(.+)`).
+			WithArgs("1.2.3.4", "spamhaus-zen", int64(2), 3).
+			WillReturnRows(rows)
+
+		history, err := GetLookupHistory(db, net.ParseIP("1.2.3.4"), "spamhaus-zen", 2, &after)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		if len(history.Edges) != 1 || history.PageInfo.HasNextPage {
+			t.Errorf("got %d edges and next page %t, want 1 edge and no next page", len(history.Edges), history.PageInfo.HasNextPage)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should return error for invalid page size", func(t *testing.T) {
+		_, err := GetLookupHistory(db, net.ParseIP("1.2.3.4"), "spamhaus-zen", MaxPageSize+1, nil)
+		if err != ErrorInvalidPageSize {
+			t.Errorf("got error '%s', wanted '%s'", err, ErrorInvalidPageSize)
+		}
+	})
+
+	t.Run("should return error if query fails", func(t *testing.T) {
+		queryError := errors.New("unable to query")
+		mock.
+			ExpectQuery(`SELECT(.+)FROM lookup_history(.+)`).
+			WillReturnError(queryError)
+
+		_, err := GetLookupHistory(db, net.ParseIP("1.2.3.4"), "spamhaus-zen", 2, nil)
+		if err != queryError {
+			t.Errorf("got error '%s', wanted '%s'", err, queryError)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
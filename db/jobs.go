@@ -0,0 +1,296 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Error definitions
+var ErrorJobNotFound error = errors.New("could not find a job with the given ID")
+
+// JobItem is a single enqueued IP of a job
+type JobItem struct {
+	ID        int64
+	JobID     string
+	IPAddress string
+	State     model.JobItemState
+	Error     *string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CreateJob stores a job with one pending item per IP and returns the job's ID
+func CreateJob(db *sql.DB, ips []string) (string, error) {
+	id := uuid.NewV4().String()
+	now := dbTime(time.Now())
+
+	// The job and its items are stored together so that no IP is lost
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO jobs (id, created_at) VALUES ($1, $2)`, id, now)
+	if err != nil {
+		return "", err
+	}
+
+	itemStatement, err := tx.Prepare(`
+	INSERT INTO job_items (job_id, ip_address, state, created_at, updated_at)
+	VALUES ($1, $2, $3, $4, $4)
+	`)
+	if err != nil {
+		return "", err
+	}
+	defer itemStatement.Close()
+
+	for _, ip := range ips {
+		_, err = itemStatement.Exec(id, ip, model.JobItemStatePending, now)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+// GetJob gets a job along with the number of its items in each state
+func GetJob(db *sql.DB, id string) (*model.Job, error) {
+	job := &model.Job{ID: id}
+
+	err := db.QueryRow(`SELECT created_at FROM jobs WHERE id = $1`, id).Scan(&job.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrorJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	SELECT state, COUNT(*)
+	FROM job_items
+	WHERE job_id = $1
+	GROUP BY state
+	`
+	rows, err := db.Query(query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var state model.JobItemState
+		var count int
+		err = rows.Scan(&state, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		switch state {
+		case model.JobItemStatePending:
+			job.Pending = count
+		case model.JobItemStateProcessing:
+			job.Processing = count
+		case model.JobItemStateDone:
+			job.Done = count
+		case model.JobItemStateFailed:
+			job.Failed = count
+		}
+		job.Submitted += count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	job.State = jobState(job)
+	return job, nil
+}
+
+// jobState derives the state of a job from the number of its items in each state
+func jobState(job *model.Job) model.JobState {
+	switch {
+	case job.Pending == job.Submitted:
+		return model.JobStatePending
+	case job.Pending > 0 || job.Processing > 0:
+		return model.JobStateProcessing
+	case job.Failed > 0:
+		return model.JobStateFailed
+	default:
+		return model.JobStateCompleted
+	}
+}
+
+// GetJobItems gets the items of a job in the order they were enqueued, optionally only those in the given state
+func GetJobItems(db *sql.DB, jobID string, state *model.JobItemState) ([]*model.JobItem, error) {
+	query := `
+	SELECT ip_address, state, error, updated_at
+	FROM job_items
+	WHERE job_id = $1 AND (CAST($2 AS TEXT) IS NULL OR state = $2)
+	ORDER BY id
+	`
+	rows, err := db.Query(query, jobID, state)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*model.JobItem{}
+	for rows.Next() {
+		var ipAddress string
+		item := &model.JobItem{}
+		err = rows.Scan(&ipAddress, &item.State, &item.Error, &item.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		item.IPAddress = net.ParseIP(ipAddress)
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// ClaimJobItems marks up to limit pending job items as processing by the given owner and returns
+// them, oldest first
+func ClaimJobItems(db *sql.DB, owner string, limit int) ([]JobItem, error) {
+	return claimJobItems(db, owner, limit, "")
+}
+
+// claimJobItems claims job items, locking the selected rows with the given clause on databases
+// where several replicas may claim items at the same time
+func claimJobItems(db *sql.DB, owner string, limit int, lock string) ([]JobItem, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	SELECT id, job_id, ip_address, state, error, created_at, updated_at
+	FROM job_items
+	WHERE state = $1
+	ORDER BY id
+	LIMIT $2
+	` + lock
+	rows, err := tx.Query(query, model.JobItemStatePending, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []JobItem{}
+	for rows.Next() {
+		item := JobItem{}
+		err = rows.Scan(&item.ID, &item.JobID, &item.IPAddress, &item.State, &item.Error, &item.CreatedAt, &item.UpdatedAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Claim the items so they are not handed out twice
+	now := dbTime(time.Now())
+	for i := range items {
+		query := `UPDATE job_items SET state = $1, claimed_by = $2, updated_at = $3 WHERE id = $4`
+		_, err = tx.Exec(query, model.JobItemStateProcessing, owner, now, items[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		items[i].State = model.JobItemStateProcessing
+		items[i].UpdatedAt = now
+	}
+
+	return items, tx.Commit()
+}
+
+// CompleteJobItem marks a job item as done, or as failed if an error is given
+func CompleteJobItem(db *sql.DB, id int64, itemErr error) error {
+	state := model.JobItemStateDone
+	var message *string
+	if itemErr != nil {
+		errorMessage := itemErr.Error()
+		state = model.JobItemStateFailed
+		message = &errorMessage
+	}
+
+	query := `UPDATE job_items SET state = $1, error = $2, updated_at = $3 WHERE id = $4`
+	_, err := db.Exec(query, state, message, dbTime(time.Now()), id)
+	return err
+}
+
+// RenewJobItems refreshes the claim of the given owner on the job items it is processing, so that
+// they are not reset while it is still alive
+func RenewJobItems(db *sql.DB, owner string) (int64, error) {
+	query := `UPDATE job_items SET updated_at = $1 WHERE state = $2 AND claimed_by = $3`
+	result, err := db.Exec(query, dbTime(time.Now()), model.JobItemStateProcessing, owner)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ResetJobItems returns job items whose claim was last refreshed before the given time, i.e. that
+// were being processed by a replica which has since stopped, to the pending state so they are
+// picked up again
+func ResetJobItems(db *sql.DB, claimedBefore time.Time) (int64, error) {
+	query := `UPDATE job_items SET state = $1, claimed_by = NULL, updated_at = $2 WHERE state = $3 AND updated_at < $4`
+	result, err := db.Exec(query, model.JobItemStatePending, dbTime(time.Now()), model.JobItemStateProcessing, dbTime(claimedBefore))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetStaleIPs gets up to limit IPs with a listed result last updated before listedBefore, or
+// any other result last updated before cleanBefore, least recently updated first. IPs that are
+// already waiting to be looked up are left out. A zero time matches no results.
+func GetStaleIPs(db *sql.DB, listedBefore time.Time, cleanBefore time.Time, limit int) ([]string, error) {
+	query := `
+	SELECT ip_address
+	FROM address_results
+	WHERE (
+		(status = $1 AND updated_at < $2)
+		OR (status != $1 AND updated_at < $3)
+	)
+	AND ip_address NOT IN (SELECT ip_address FROM job_items WHERE state IN ($4, $5))
+	GROUP BY ip_address
+	ORDER BY MIN(updated_at)
+	LIMIT $6
+	`
+	rows, err := db.Query(
+		query,
+		model.LookupStatusListed,
+		dbTime(listedBefore),
+		dbTime(cleanBefore),
+		model.JobItemStatePending,
+		model.JobItemStateProcessing,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ips := []string{}
+	for rows.Next() {
+		var ip string
+		err = rows.Scan(&ip)
+		if err != nil {
+			return nil, err
+		}
+		ips = append(ips, ip)
+	}
+
+	return ips, rows.Err()
+}
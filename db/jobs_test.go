@@ -0,0 +1,419 @@
+package db
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestCreateJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	t.Run("should store job and its items", func(t *testing.T) {
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(`INSERT INTO jobs(.+)`).
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectPrepare(`INSERT INTO job_items(.+)`)
+		for _, ip := range []string{"1.2.3.4", "5.6.7.8"} {
+			mock.
+				ExpectExec(`INSERT INTO job_items(.+)`).
+				WithArgs(sqlmock.AnyArg(), ip, model.JobItemStatePending, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+		}
+		mock.ExpectCommit()
+
+		id, err := CreateJob(db, []string{"1.2.3.4", "5.6.7.8"})
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+		if id == "" {
+			t.Error("got empty job ID")
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should roll back if an item cannot be stored", func(t *testing.T) {
+		executionError := errors.New("sql error")
+
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(`INSERT INTO jobs(.+)`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectPrepare(`INSERT INTO job_items(.+)`)
+		mock.
+			ExpectExec(`INSERT INTO job_items(.+)`).
+			WillReturnError(executionError)
+		mock.ExpectRollback()
+
+		_, err := CreateJob(db, []string{"1.2.3.4"})
+		if err != executionError {
+			t.Errorf("got error '%s', wanted '%s'", err, executionError)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestGetJob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	tests := []struct {
+		description string
+		counts      map[model.JobItemState]int
+		want        model.Job
+	}{
+		{
+			description: "should report pending job",
+			counts:      map[model.JobItemState]int{model.JobItemStatePending: 2},
+			want:        model.Job{ID: "job", State: model.JobStatePending, Submitted: 2, Pending: 2, CreatedAt: now},
+		},
+		{
+			description: "should report processing job",
+			counts:      map[model.JobItemState]int{model.JobItemStatePending: 1, model.JobItemStateDone: 1},
+			want:        model.Job{ID: "job", State: model.JobStateProcessing, Submitted: 2, Pending: 1, Done: 1, CreatedAt: now},
+		},
+		{
+			description: "should report completed job",
+			counts:      map[model.JobItemState]int{model.JobItemStateDone: 2},
+			want:        model.Job{ID: "job", State: model.JobStateCompleted, Submitted: 2, Done: 2, CreatedAt: now},
+		},
+		{
+			description: "should report failed job",
+			counts:      map[model.JobItemState]int{model.JobItemStateDone: 1, model.JobItemStateFailed: 1},
+			want:        model.Job{ID: "job", State: model.JobStateFailed, Submitted: 2, Done: 1, Failed: 1, CreatedAt: now},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			mock.
+				ExpectQuery(`SELECT created_at FROM jobs(.+)`).
+				WithArgs("job").
+				WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(now))
+
+			rows := sqlmock.NewRows([]string{"state", "count"})
+			for _, state := range model.AllJobItemState {
+				if count, ok := test.counts[state]; ok {
+					rows.AddRow(state, count)
+				}
+			}
+			mock.
+				ExpectQuery(`SELECT state, COUNT(.+)FROM job_items(.+)`).
+				WithArgs("job").
+				WillReturnRows(rows)
+
+			job, err := GetJob(db, "job")
+			if err != nil {
+				t.Fatalf("error: '%s'", err)
+			}
+
+			if !reflect.DeepEqual(*job, test.want) {
+				t.Errorf("got '%v', want '%v'", *job, test.want)
+			}
+
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("expectations were not met: '%s'", err)
+			}
+		})
+	}
+
+	t.Run("should return error if job does not exist", func(t *testing.T) {
+		mock.
+			ExpectQuery(`SELECT created_at FROM jobs(.+)`).
+			WithArgs("missing").
+			WillReturnRows(sqlmock.NewRows([]string{"created_at"}))
+
+		_, err := GetJob(db, "missing")
+		if err != ErrorJobNotFound {
+			t.Errorf("got error '%s', wanted '%s'", err, ErrorJobNotFound)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestGetJobItems(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	t.Run("should return items in the given state", func(t *testing.T) {
+		now := time.Now().UTC().Truncate(time.Second)
+		message := "lookup failed"
+		state := model.JobItemStateFailed
+
+		rows := sqlmock.
+			NewRows([]string{"ip_address", "state", "error", "updated_at"}).
+			AddRow("1.2.3.4", model.JobItemStateFailed, message, now)
+		mock.
+			ExpectQuery(`SELECT(.+)FROM job_items(.+)`).
+			WithArgs("job", state).
+			WillReturnRows(rows)
+
+		items, err := GetJobItems(db, "job", &state)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		want := []*model.JobItem{{IPAddress: net.ParseIP("1.2.3.4"), State: model.JobItemStateFailed, Error: &message, UpdatedAt: now}}
+		if !reflect.DeepEqual(items, want) {
+			t.Errorf("got '%v', want '%v'", items, want)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestClaimJobItems(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	t.Run("should claim pending items", func(t *testing.T) {
+		now := time.Now().UTC().Truncate(time.Second)
+		rows := sqlmock.
+			NewRows([]string{"id", "job_id", "ip_address", "state", "error", "created_at", "updated_at"}).
+			AddRow(1, "job", "1.2.3.4", model.JobItemStatePending, nil, now, now).
+			AddRow(2, "job", "5.6.7.8", model.JobItemStatePending, nil, now, now)
+
+		mock.ExpectBegin()
+		mock.
+			ExpectQuery(`SELECT(.+)FROM job_items(.+)`).
+			WithArgs(model.JobItemStatePending, 10).
+			WillReturnRows(rows)
+		for _, id := range []int64{1, 2} {
+			mock.
+				ExpectExec(`UPDATE job_items SET state(.+)`).
+				WithArgs(model.JobItemStateProcessing, "owner", sqlmock.AnyArg(), id).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+		mock.ExpectCommit()
+
+		items, err := ClaimJobItems(db, "owner", 10)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		if len(items) != 2 || items[0].IPAddress != "1.2.3.4" || items[1].State != model.JobItemStateProcessing {
+			t.Errorf("got %v, want 2 claimed items", items)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should return error if query fails", func(t *testing.T) {
+		queryError := errors.New("unable to query")
+
+		mock.ExpectBegin()
+		mock.
+			ExpectQuery(`SELECT(.+)FROM job_items(.+)`).
+			WillReturnError(queryError)
+		mock.ExpectRollback()
+
+		_, err := ClaimJobItems(db, "owner", 10)
+		if err != queryError {
+			t.Errorf("got error '%s', wanted '%s'", err, queryError)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestCompleteJobItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	t.Run("should mark item as done", func(t *testing.T) {
+		mock.
+			ExpectExec(`UPDATE job_items SET state(.+)`).
+			WithArgs(model.JobItemStateDone, nil, sqlmock.AnyArg(), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err = CompleteJobItem(db, 1, nil)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should mark item as failed with error", func(t *testing.T) {
+		mock.
+			ExpectExec(`UPDATE job_items SET state(.+)`).
+			WithArgs(model.JobItemStateFailed, "lookup failed", sqlmock.AnyArg(), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err = CompleteJobItem(db, 1, errors.New("lookup failed"))
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestRenewJobItems(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	t.Run("should refresh the owner's processing items", func(t *testing.T) {
+		mock.
+			ExpectExec(`UPDATE job_items SET updated_at(.+)`).
+			WithArgs(sqlmock.AnyArg(), model.JobItemStateProcessing, "owner").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		renewed, err := RenewJobItems(db, "owner")
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+		if renewed != 2 {
+			t.Errorf("got %d renewed items, want 2", renewed)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestResetJobItems(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	claimedBefore := time.Date(2021, 3, 1, 12, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	t.Run("should return processing items with expired claims to pending", func(t *testing.T) {
+		mock.
+			ExpectExec(`UPDATE job_items SET state(.+)`).
+			WithArgs(model.JobItemStatePending, sqlmock.AnyArg(), model.JobItemStateProcessing, time.Date(2021, 3, 1, 17, 0, 0, 0, time.UTC)).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+
+		reset, err := ResetJobItems(db, claimedBefore)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+		if reset != 3 {
+			t.Errorf("got %d reset items, want 3", reset)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestGetStaleIPs(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	listedBefore := time.Date(2021, 3, 1, 12, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+	cleanBefore := time.Date(2021, 2, 22, 12, 0, 0, 0, time.UTC)
+
+	t.Run("should return stale IPs comparing timestamps in UTC", func(t *testing.T) {
+		rows := sqlmock.NewRows([]string{"ip_address"}).AddRow("1.2.3.4").AddRow("5.6.7.8")
+		mock.
+			ExpectQuery(`SELECT ip_address(.+)FROM address_results(.+)`).
+			WithArgs(
+				model.LookupStatusListed,
+				time.Date(2021, 3, 1, 17, 0, 0, 0, time.UTC),
+				time.Date(2021, 2, 22, 12, 0, 0, 0, time.UTC),
+				model.JobItemStatePending,
+				model.JobItemStateProcessing,
+				100,
+			).
+			WillReturnRows(rows)
+
+		ips, err := GetStaleIPs(db, listedBefore, cleanBefore, 100)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		want := []string{"1.2.3.4", "5.6.7.8"}
+		if !reflect.DeepEqual(ips, want) {
+			t.Errorf("got '%v', want '%v'", ips, want)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should return error if query fails", func(t *testing.T) {
+		queryError := errors.New("unable to query")
+		mock.
+			ExpectQuery(`SELECT ip_address(.+)FROM address_results(.+)`).
+			WillReturnError(queryError)
+
+		_, err := GetStaleIPs(db, listedBefore, cleanBefore, 100)
+		if err != queryError {
+			t.Errorf("got error '%s', wanted '%s'", err, queryError)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
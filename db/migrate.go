@@ -0,0 +1,212 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Error definitions
+var ErrorInvalidMigration error = errors.New("migration file names must be formatted as <version>_<name>.sql")
+
+// migrationFiles holds the migrations of each supported database, in a directory named after its driver
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// migrationsTable records the version of each migration applied to the database
+const migrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations
+(
+	version INTEGER PRIMARY KEY,
+	name TEXT,
+	applied_at TIMESTAMP
+)
+`
+
+// Migration is a versioned change to the schema of the database
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+	// Before runs ahead of SQL, in the same transaction, for changes that cannot be made in SQL alone
+	Before func(tx *sql.Tx) error
+}
+
+// migrationFuncs holds the Before functions of each driver's migrations, by version
+var migrationFuncs = map[string]map[int]func(tx *sql.Tx) error{
+	DriverSQLite: {1: rebuildLegacyResults},
+}
+
+// MigrationState reports whether a migration was applied to the database, and when
+type MigrationState struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// loadMigrations reads the embedded migrations of the given driver, ordered by version
+func loadMigrations(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := []Migration{}
+	for _, entry := range entries {
+		// File names start with the version, e.g. 0001_create_tables.sql
+		parts := strings.SplitN(strings.TrimSuffix(entry.Name(), ".sql"), "_", 2)
+		if len(parts) != 2 || !strings.HasSuffix(entry.Name(), ".sql") {
+			return nil, ErrorInvalidMigration
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || version <= 0 {
+			return nil, ErrorInvalidMigration
+		}
+
+		content, err := fs.ReadFile(migrationFiles, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, Migration{
+			Version: version,
+			Name:    parts[1],
+			SQL:     string(content),
+			Before:  migrationFuncs[driver][version],
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// migrate applies the migrations that were not applied to the database yet, in order, and returns
+// the number of migrations applied. lock is run at the start of each migration on databases shared
+// by several replicas, so that only one of them applies it.
+func migrate(db *sql.DB, migrations []Migration, lock string) (int, error) {
+	_, err := db.Exec(migrationsTable)
+	if err != nil {
+		return 0, err
+	}
+
+	applied := 0
+	for _, migration := range migrations {
+		ok, err := applyMigration(db, migration, lock)
+		if err != nil {
+			return applied, fmt.Errorf("error applying migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+		if ok {
+			applied++
+		}
+	}
+
+	return applied, nil
+}
+
+// applyMigration applies a migration unless it was already applied. The migration is recorded
+// along with its changes, so a failed migration leaves no trace and is retried on the next run.
+func applyMigration(db *sql.DB, migration Migration, lock string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if lock != "" {
+		_, err = tx.Exec(lock)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	var count int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = $1`, migration.Version).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	if migration.Before != nil {
+		err = migration.Before(tx)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.Exec(migration.SQL)
+	if err != nil {
+		return false, err
+	}
+
+	query := `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`
+	_, err = tx.Exec(query, migration.Version, migration.Name, dbTime(time.Now()))
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// migrationStates reports the state of each of the given migrations, along with any migration
+// that was applied by a later version of the application, ordered by version
+func migrationStates(db *sql.DB, migrations []Migration) ([]*MigrationState, error) {
+	_, err := db.Exec(migrationsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[int]*MigrationState{}
+	for _, migration := range migrations {
+		states[migration.Version] = &MigrationState{Version: migration.Version, Name: migration.Name}
+	}
+
+	rows, err := db.Query(`SELECT version, name, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		state := &MigrationState{}
+		var appliedAt time.Time
+		err = rows.Scan(&state.Version, &state.Name, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		state.AppliedAt = &appliedAt
+
+		if known, ok := states[state.Version]; ok {
+			known.AppliedAt = state.AppliedAt
+			continue
+		}
+		states[state.Version] = state
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ordered := []*MigrationState{}
+	for _, state := range states {
+		ordered = append(ordered, state)
+	}
+	sort.Slice(ordered, func(i, j int) bool {
+		return ordered[i].Version < ordered[j].Version
+	})
+
+	return ordered, nil
+}
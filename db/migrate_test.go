@@ -0,0 +1,243 @@
+package db
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("should load same migrations for every driver", func(t *testing.T) {
+		sqliteMigrations, err := loadMigrations(DriverSQLite)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+		postgresMigrations, err := loadMigrations(DriverPostgres)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		if len(sqliteMigrations) != len(postgresMigrations) {
+			t.Fatalf("got %d SQLite and %d PostgreSQL migrations, want the same", len(sqliteMigrations), len(postgresMigrations))
+		}
+		for i := range sqliteMigrations {
+			// Versions count up from 1 without gaps
+			if sqliteMigrations[i].Version != i+1 || sqliteMigrations[i].SQL == "" {
+				t.Errorf("got migration %d_%s at position %d", sqliteMigrations[i].Version, sqliteMigrations[i].Name, i)
+			}
+			if sqliteMigrations[i].Version != postgresMigrations[i].Version || sqliteMigrations[i].Name != postgresMigrations[i].Name {
+				t.Errorf("got SQLite migration %d_%s, PostgreSQL migration %d_%s", sqliteMigrations[i].Version, sqliteMigrations[i].Name, postgresMigrations[i].Version, postgresMigrations[i].Name)
+			}
+		}
+	})
+
+	t.Run("should return error for unknown driver", func(t *testing.T) {
+		_, err := loadMigrations("mysql")
+		if err == nil {
+			t.Error("didn't get an error but wanted one")
+		}
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	migrations := []Migration{
+		{Version: 1, Name: "create_tables", SQL: "CREATE TABLE jobs (id TEXT)"},
+		{Version: 2, Name: "index_jobs", SQL: "CREATE INDEX jobs_id ON jobs (id)"},
+	}
+
+	t.Run("should only apply pending migrations", func(t *testing.T) {
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`LOCK TABLE schema_migrations(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.
+			ExpectQuery(`SELECT COUNT\(\*\) FROM schema_migrations(.+)`).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+		mock.ExpectRollback()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`LOCK TABLE schema_migrations(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.
+			ExpectQuery(`SELECT COUNT\(\*\) FROM schema_migrations(.+)`).
+			WithArgs(2).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectExec(`CREATE INDEX jobs_id(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.
+			ExpectExec(`INSERT INTO schema_migrations(.+)`).
+			WithArgs(2, "index_jobs", sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		applied, err := migrate(db, migrations, postgresMigrationLock)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+		if applied != 1 {
+			t.Errorf("got %d migrations applied, want 1", applied)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should roll back failed migration", func(t *testing.T) {
+		migrationError := errors.New("syntax error")
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectBegin()
+		mock.
+			ExpectQuery(`SELECT COUNT\(\*\) FROM schema_migrations(.+)`).
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+		mock.ExpectExec(`CREATE TABLE jobs(.+)`).WillReturnError(migrationError)
+		mock.ExpectRollback()
+
+		applied, err := migrate(db, migrations, "")
+		if !errors.Is(err, migrationError) {
+			t.Errorf("got error '%s', wanted '%s'", err, migrationError)
+		}
+		if applied != 0 {
+			t.Errorf("got %d migrations applied, want 0", applied)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestMigrationStates(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	t.Run("should report applied, pending and unknown migrations", func(t *testing.T) {
+		appliedAt := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS schema_migrations(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.
+			ExpectQuery(`SELECT version, name, applied_at FROM schema_migrations`).
+			WillReturnRows(sqlmock.NewRows([]string{"version", "name", "applied_at"}).
+				AddRow(1, "create_tables", appliedAt).
+				AddRow(3, "add_column", appliedAt))
+
+		states, err := migrationStates(db, []Migration{
+			{Version: 1, Name: "create_tables"},
+			{Version: 2, Name: "index_jobs"},
+		})
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		want := []*MigrationState{
+			{Version: 1, Name: "create_tables", AppliedAt: &appliedAt},
+			{Version: 2, Name: "index_jobs"},
+			{Version: 3, Name: "add_column", AppliedAt: &appliedAt},
+		}
+		if !reflect.DeepEqual(states, want) {
+			t.Errorf("got %v, want %v", states, want)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestMigrateLegacyDatabase(t *testing.T) {
+	store, err := Open(DriverSQLite, ":memory:")
+	if err != nil {
+		t.Fatalf("error: '%s'", err)
+	}
+	defer store.Close()
+	database := store.(*SQLiteStore).db
+
+	// Schema and rows as stored by the first version of the application
+	statements := []string{
+		`
+		CREATE TABLE IF NOT EXISTS address_results 
+		(
+			uuid TEXT UNIQUE, 
+			response_code TEXT, 
+			ip_address TEXT UNIQUE PRIMARY KEY,
+			created_at TEXT, 
+			updated_at TEXT
+		)
+		`,
+		`
+		INSERT INTO address_results (uuid, ip_address, response_code, created_at, updated_at)
+		VALUES ('uuid-1', '127.0.0.2', '127.0.0.4', '2021-03-01T07:00:00-05:00', '2021-03-02T07:00:00-05:00')
+		`,
+	}
+	for _, statement := range statements {
+		_, err = database.Exec(statement)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+	}
+
+	t.Run("should rebuild results of the first version", func(t *testing.T) {
+		_, err := store.Migrate()
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		results, err := store.GetNetworkResults("127.0.0.0/24", 8)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+		if len(results.Results) != 1 {
+			t.Fatalf("got %d results, want 1", len(results.Results))
+		}
+
+		result := results.Results[0]
+		if result.UUID != "uuid-1" || result.Zone != legacyZone || result.Status != model.LookupStatusListed {
+			t.Errorf("got result %s in zone %s with status %s", result.UUID, result.Zone, result.Status)
+		}
+		if result.ResponseCode == nil || *result.ResponseCode != "127.0.0.4" {
+			t.Errorf("got response code %v, want 127.0.0.4", result.ResponseCode)
+		}
+		if !result.UpdatedAt.Equal(time.Date(2021, 3, 2, 12, 0, 0, 0, time.UTC)) {
+			t.Errorf("got updated at %s, want 2021-03-02T12:00:00Z", result.UpdatedAt)
+		}
+	})
+
+	t.Run("should store results of other zones", func(t *testing.T) {
+		now := time.Now().UTC()
+		err := store.UpsertIPLookupResult(model.IPLookupResult{
+			UUID:      "uuid-2",
+			IPAddress: net.ParseIP("127.0.0.2"),
+			Zone:      "spamcop",
+			Status:    model.LookupStatusNotListed,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		results, err := store.GetIPLookupResults(net.ParseIP("127.0.0.2"))
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+		if len(results) != 2 {
+			t.Errorf("got %d results, want 2", len(results))
+		}
+	})
+}
@@ -0,0 +1,64 @@
+-- Creates the tables used before versioned migrations. Every statement only creates what is
+-- missing, so databases set up by earlier versions are adopted as they are.
+-- Lookup results are paged by a rowid column, which SQLite provides implicitly.
+
+CREATE TABLE IF NOT EXISTS address_results
+(
+	rowid BIGSERIAL,
+	uuid TEXT UNIQUE,
+	response_code TEXT,
+	ip_address TEXT,
+	ip_bytes BYTEA,
+	zone TEXT,
+	status TEXT,
+	error_class TEXT,
+	reason TEXT,
+	created_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ,
+	PRIMARY KEY (ip_address, zone)
+);
+CREATE INDEX IF NOT EXISTS address_results_rowid ON address_results (rowid);
+CREATE INDEX IF NOT EXISTS address_results_status ON address_results (status, response_code);
+CREATE INDEX IF NOT EXISTS address_results_updated_at ON address_results (updated_at);
+CREATE INDEX IF NOT EXISTS address_results_ip_bytes ON address_results (ip_bytes);
+
+CREATE TABLE IF NOT EXISTS jobs
+(
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS job_items
+(
+	id BIGSERIAL PRIMARY KEY,
+	job_id TEXT REFERENCES jobs (id),
+	ip_address TEXT,
+	state TEXT,
+	error TEXT,
+	created_at TIMESTAMPTZ,
+	updated_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS job_items_state ON job_items (state, id);
+
+CREATE TABLE IF NOT EXISTS lookup_history
+(
+	id BIGSERIAL PRIMARY KEY,
+	ip_address TEXT,
+	zone TEXT,
+	status TEXT,
+	response_code TEXT,
+	error_class TEXT,
+	checked_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS lookup_history_ip_address ON lookup_history (ip_address, zone, id);
+
+CREATE TABLE IF NOT EXISTS listing_events
+(
+	id BIGSERIAL PRIMARY KEY,
+	ip_address TEXT,
+	zone TEXT,
+	type TEXT,
+	previous_response_code TEXT,
+	response_code TEXT,
+	created_at TIMESTAMPTZ
+);
@@ -0,0 +1,2 @@
+-- Looks up the items of a job without scanning every job item
+CREATE INDEX job_items_job_id ON job_items (job_id, id);
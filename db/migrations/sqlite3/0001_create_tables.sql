@@ -0,0 +1,62 @@
+-- Creates the tables used before versioned migrations. Every statement only creates what is
+-- missing, so databases set up by earlier versions are adopted as they are. Databases of the first
+-- version, which stored a single result per IP, are rebuilt beforehand by rebuildLegacyResults.
+
+CREATE TABLE IF NOT EXISTS address_results
+(
+	uuid TEXT UNIQUE,
+	response_code TEXT,
+	ip_address TEXT,
+	ip_bytes BLOB,
+	zone TEXT,
+	status TEXT,
+	error_class TEXT,
+	reason TEXT,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP,
+	PRIMARY KEY (ip_address, zone)
+);
+CREATE INDEX IF NOT EXISTS address_results_status ON address_results (status, response_code);
+CREATE INDEX IF NOT EXISTS address_results_updated_at ON address_results (updated_at);
+CREATE INDEX IF NOT EXISTS address_results_ip_bytes ON address_results (ip_bytes);
+
+CREATE TABLE IF NOT EXISTS jobs
+(
+	id TEXT PRIMARY KEY,
+	created_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS job_items
+(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	job_id TEXT REFERENCES jobs (id),
+	ip_address TEXT,
+	state TEXT,
+	error TEXT,
+	created_at TIMESTAMP,
+	updated_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS job_items_state ON job_items (state, id);
+
+CREATE TABLE IF NOT EXISTS lookup_history
+(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	ip_address TEXT,
+	zone TEXT,
+	status TEXT,
+	response_code TEXT,
+	error_class TEXT,
+	checked_at TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS lookup_history_ip_address ON lookup_history (ip_address, zone, id);
+
+CREATE TABLE IF NOT EXISTS listing_events
+(
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	ip_address TEXT,
+	zone TEXT,
+	type TEXT,
+	previous_response_code TEXT,
+	response_code TEXT,
+	created_at TIMESTAMP
+);
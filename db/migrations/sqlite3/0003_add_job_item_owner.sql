@@ -0,0 +1,2 @@
+-- Records which replica is processing a job item, so that it can keep its claim on the item alive
+ALTER TABLE job_items ADD COLUMN claimed_by TEXT;
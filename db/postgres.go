@@ -0,0 +1,27 @@
+package db
+
+import (
+	"database/sql"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresMigrationLock keeps replicas that start at the same time from applying a migration twice
+const postgresMigrationLock = `LOCK TABLE schema_migrations IN EXCLUSIVE MODE`
+
+// PostgresStore stores data in a PostgreSQL database, which can be shared by several replicas of
+// the application
+type PostgresStore struct {
+	sqlStore
+}
+
+// NewPostgresStore creates a store on top of an open PostgreSQL database
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{sqlStore{db: db, driver: DriverPostgres, migrationLock: postgresMigrationLock}}
+}
+
+// ClaimJobItems skips items that another replica is claiming at the same time, so that no item
+// is looked up twice
+func (s *PostgresStore) ClaimJobItems(owner string, limit int) ([]JobItem, error) {
+	return claimJobItems(s.db, owner, limit, "FOR UPDATE SKIP LOCKED")
+}
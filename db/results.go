@@ -0,0 +1,209 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strings"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+// Error definitions
+var ErrorInvalidCIDR error = errors.New("provided CIDR is not a valid network")
+var ErrorNetworkTooLarge error = errors.New("provided network is too large, page through lookupResults with a cidr filter instead")
+
+// resultsConnection names the cursors of the lookup results connection
+const resultsConnection = "results"
+
+// ipBytes returns the sortable form of an IP stored alongside each result. IPv4 addresses are
+// stored in their IPv4-mapped IPv6 form, so IPv4 and IPv6 addresses share a single ordering.
+func ipBytes(ip net.IP) []byte {
+	return []byte(ip.To16())
+}
+
+// networkRange returns the sortable forms of the first and last IP of a network
+func networkRange(network *net.IPNet) ([]byte, []byte) {
+	first := network.IP.Mask(network.Mask)
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^network.Mask[i]
+	}
+	return ipBytes(first), ipBytes(last)
+}
+
+// GetLookupResults gets a page of the stored lookup results matching the filter, in the order they
+// were first stored. The page starts after the given cursor, if any.
+func GetLookupResults(db *sql.DB, first int, after *string, filter *model.LookupResultFilter) (*model.LookupResultConnection, error) {
+	err := validatePageSize(first)
+	if err != nil {
+		return nil, err
+	}
+
+	// Start from the first result unless a cursor is given
+	var afterID int64 = math.MinInt64
+	if after != nil {
+		afterID, err = DecodeCursor(resultsConnection, *after)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Each condition refers to its arguments by their position
+	args := []interface{}{afterID}
+	conditions := []string{"rowid > $1"}
+	if filter != nil {
+		if filter.Status != nil {
+			args = append(args, *filter.Status)
+			conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+		}
+		if filter.ResponseCode != nil {
+			// IPs listed for several reasons have every response code stored, separated by commas
+			args = append(args, *filter.ResponseCode)
+			conditions = append(conditions, fmt.Sprintf("',' || response_code || ',' LIKE '%%,' || CAST($%d AS TEXT) || ',%%'", len(args)))
+		}
+		if filter.UpdatedSince != nil {
+			args = append(args, dbTime(*filter.UpdatedSince))
+			conditions = append(conditions, fmt.Sprintf("updated_at >= $%d", len(args)))
+		}
+		if filter.Cidr != nil {
+			_, network, err := net.ParseCIDR(*filter.Cidr)
+			if err != nil {
+				return nil, ErrorInvalidCIDR
+			}
+
+			firstIP, lastIP := networkRange(network)
+			args = append(args, firstIP, lastIP)
+			conditions = append(conditions, fmt.Sprintf("ip_bytes BETWEEN $%d AND $%d", len(args)-1, len(args)))
+		}
+	}
+
+	// Fetch one more result than requested to find out whether there is a next page
+	args = append(args, first+1)
+	query := fmt.Sprintf(`
+	SELECT rowid, uuid, ip_address, zone, status, response_code, error_class, reason, created_at, updated_at
+	FROM address_results
+	WHERE %s
+	ORDER BY rowid
+	LIMIT $%d
+	`, strings.Join(conditions, " AND "), len(args))
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	connection := &model.LookupResultConnection{
+		Edges:    []*model.LookupResultEdge{},
+		PageInfo: &model.PageInfo{},
+	}
+	for rows.Next() {
+		if len(connection.Edges) == first {
+			connection.PageInfo.HasNextPage = true
+			break
+		}
+
+		var id int64
+		var ipAddress string
+		result := &model.IPLookupResult{}
+		err = rows.Scan(
+			&id,
+			&result.UUID,
+			&ipAddress,
+			&result.Zone,
+			&result.Status,
+			&result.ResponseCode,
+			&result.ErrorClass,
+			&result.Reason,
+			&result.CreatedAt,
+			&result.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		result.IPAddress = net.ParseIP(ipAddress)
+
+		cursor := EncodeCursor(resultsConnection, id)
+		connection.Edges = append(connection.Edges, &model.LookupResultEdge{Cursor: cursor, Node: result})
+		connection.PageInfo.EndCursor = &cursor
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return connection, nil
+}
+
+// GetNetworkResults gets every stored lookup result of the IPs inside the given network, ordered
+// by IP, along with a summary of how many of these IPs were checked, are listed by at least one
+// zone or are clean according to every zone that could be queried. Since every result is returned
+// at once, networks with more than maxRangeBits host bits are rejected.
+func GetNetworkResults(db *sql.DB, cidr string, maxRangeBits int) (*model.NetworkResults, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, ErrorInvalidCIDR
+	}
+
+	ones, bits := network.Mask.Size()
+	if bits-ones > maxRangeBits {
+		return nil, ErrorNetworkTooLarge
+	}
+
+	// The ip_bytes index covers the whole range
+	firstIP, lastIP := networkRange(network)
+	rows, err := db.Query(`
+	SELECT uuid, ip_address, zone, status, response_code, error_class, reason, created_at, updated_at
+	FROM address_results
+	WHERE ip_bytes BETWEEN $1 AND $2
+	ORDER BY ip_bytes, zone
+	`, firstIP, lastIP)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results, err := scanIPLookupResults(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.NetworkResults{
+		Cidr:    network.String(),
+		Summary: summarizeResults(results),
+		Results: results,
+	}, nil
+}
+
+// summarizeResults counts the IPs of the given results by whether any zone lists them. IPs whose
+// lookups all failed are only counted as checked.
+func summarizeResults(results []*model.IPLookupResult) *model.NetworkSummary {
+	listed := map[string]bool{}
+	clean := map[string]bool{}
+	checked := map[string]bool{}
+	for _, result := range results {
+		ip := result.IPAddress.String()
+		checked[ip] = true
+
+		switch result.Status {
+		case model.LookupStatusListed:
+			listed[ip] = true
+		case model.LookupStatusNotListed:
+			clean[ip] = true
+		}
+	}
+
+	// An IP is only clean if no zone lists it
+	for ip := range listed {
+		delete(clean, ip)
+	}
+
+	return &model.NetworkSummary{
+		Checked: len(checked),
+		Listed:  len(listed),
+		Clean:   len(clean),
+	}
+}
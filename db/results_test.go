@@ -0,0 +1,210 @@
+package db
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestNetworkRange(t *testing.T) {
+	tests := []struct {
+		description string
+		input       string
+		wantFirst   string
+		wantLast    string
+	}{
+		{
+			description: "should return range of IPv4 network",
+			input:       "203.0.113.0/24",
+			wantFirst:   "203.0.113.0",
+			wantLast:    "203.0.113.255",
+		},
+		{
+			description: "should return range of IPv4 network given a host address",
+			input:       "10.1.2.3/22",
+			wantFirst:   "10.1.0.0",
+			wantLast:    "10.1.3.255",
+		},
+		{
+			description: "should return range of IPv6 network",
+			input:       "2001:db8::/120",
+			wantFirst:   "2001:db8::",
+			wantLast:    "2001:db8::ff",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			_, network, err := net.ParseCIDR(test.input)
+			if err != nil {
+				t.Fatalf("error: '%s'", err)
+			}
+
+			first, last := networkRange(network)
+			if net.IP(first).String() != test.wantFirst || net.IP(last).String() != test.wantLast {
+				t.Errorf("got %s - %s, want %s - %s", net.IP(first), net.IP(last), test.wantFirst, test.wantLast)
+			}
+		})
+	}
+}
+
+func TestGetLookupResults(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	columns := []string{"rowid", "uuid", "ip_address", "zone", "status", "response_code", "error_class", "reason", "created_at", "updated_at"}
+
+	t.Run("should return filtered page after cursor", func(t *testing.T) {
+		after := EncodeCursor(resultsConnection, 4)
+		status := model.LookupStatusListed
+		updatedSince := time.Date(2021, 3, 1, 7, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+		updatedAt := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+		cidr := "203.0.113.0/24"
+
+		rows := sqlmock.NewRows(columns).
+			AddRow(5, "uuid-5", "203.0.113.5", "spamhaus-zen", model.LookupStatusListed, "127.0.0.4", nil, nil, updatedAt, updatedAt).
+			AddRow(9, "uuid-9", "203.0.113.9", "spamhaus-zen", model.LookupStatusListed, "127.0.0.2", nil, nil, updatedAt, updatedAt)
+		mock.
+			ExpectQuery(`SELECT(.+)FROM address_results(.+)status = \$2 AND updated_at >= \$3 AND ip_bytes BETWEEN \$4 AND \$5(.+)LIMIT \$6`).
+			WithArgs(
+				int64(4),
+				status,
+				updatedAt,
+				[]byte(net.ParseIP("203.0.113.0").To16()),
+				[]byte(net.ParseIP("203.0.113.255").To16()),
+				2,
+			).
+			WillReturnRows(rows)
+
+		results, err := GetLookupResults(db, 1, &after, &model.LookupResultFilter{Status: &status, UpdatedSince: &updatedSince, Cidr: &cidr})
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		if len(results.Edges) != 1 || results.Edges[0].Node.UUID != "uuid-5" {
+			t.Errorf("got %v, want only the first result", results.Edges)
+		}
+		if !results.PageInfo.HasNextPage || *results.PageInfo.EndCursor != EncodeCursor(resultsConnection, 5) {
+			t.Errorf("got page info %v, want next page after first result", results.PageInfo)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should return error for invalid CIDR", func(t *testing.T) {
+		invalidCIDR := "203.0.113.0"
+
+		_, err := GetLookupResults(db, 10, nil, &model.LookupResultFilter{Cidr: &invalidCIDR})
+		if err != ErrorInvalidCIDR {
+			t.Errorf("got error '%s', wanted '%s'", err, ErrorInvalidCIDR)
+		}
+	})
+
+	t.Run("should return error if query fails", func(t *testing.T) {
+		queryError := errors.New("unable to query")
+		mock.
+			ExpectQuery(`SELECT(.+)FROM address_results(.+)`).
+			WillReturnError(queryError)
+
+		_, err := GetLookupResults(db, 10, nil, nil)
+		if err != queryError {
+			t.Errorf("got error '%s', wanted '%s'", err, queryError)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestGetNetworkResults(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	columns := []string{"uuid", "ip_address", "zone", "status", "response_code", "error_class", "reason", "created_at", "updated_at"}
+
+	t.Run("should return results inside network with summary", func(t *testing.T) {
+		updatedAt := time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC)
+		rows := sqlmock.NewRows(columns).
+			AddRow("uuid-1", "203.0.113.1", "spamcop", model.LookupStatusNotListed, nil, nil, nil, updatedAt, updatedAt).
+			AddRow("uuid-2", "203.0.113.1", "spamhaus-zen", model.LookupStatusListed, "127.0.0.2", nil, nil, updatedAt, updatedAt).
+			AddRow("uuid-3", "203.0.113.2", "spamhaus-zen", model.LookupStatusNotListed, nil, nil, nil, updatedAt, updatedAt).
+			AddRow("uuid-4", "203.0.113.3", "spamhaus-zen", model.LookupStatusError, nil, model.DNSErrorClassTimeout, nil, updatedAt, updatedAt)
+		mock.
+			ExpectQuery(`SELECT(.+)FROM address_results(.+)ip_bytes BETWEEN \$1 AND \$2(.+)`).
+			WithArgs(
+				[]byte(net.ParseIP("203.0.113.0").To16()),
+				[]byte(net.ParseIP("203.0.113.255").To16()),
+			).
+			WillReturnRows(rows)
+
+		results, err := GetNetworkResults(db, "203.0.113.7/24", 8)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		if results.Cidr != "203.0.113.0/24" {
+			t.Errorf("got CIDR %s, want normalized network", results.Cidr)
+		}
+		if len(results.Results) != 4 {
+			t.Errorf("got %d results, want 4", len(results.Results))
+		}
+
+		want := &model.NetworkSummary{Checked: 3, Listed: 1, Clean: 1}
+		if *results.Summary != *want {
+			t.Errorf("got summary %v, want %v", results.Summary, want)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should return error for invalid CIDR", func(t *testing.T) {
+		_, err := GetNetworkResults(db, "203.0.113.0", 8)
+		if err != ErrorInvalidCIDR {
+			t.Errorf("got error '%s', wanted '%s'", err, ErrorInvalidCIDR)
+		}
+	})
+
+	t.Run("should return error for network larger than the limit", func(t *testing.T) {
+		for _, cidr := range []string{"203.0.113.0/23", "0.0.0.0/0", "::/0"} {
+			_, err := GetNetworkResults(db, cidr, 8)
+			if err != ErrorNetworkTooLarge {
+				t.Errorf("got error '%s' for %s, wanted '%s'", err, cidr, ErrorNetworkTooLarge)
+			}
+		}
+	})
+
+	t.Run("should return error if query fails", func(t *testing.T) {
+		queryError := errors.New("unable to query")
+		mock.
+			ExpectQuery(`SELECT(.+)FROM address_results(.+)`).
+			WillReturnError(queryError)
+
+		_, err := GetNetworkResults(db, "2001:db8::/120", 8)
+		if err != queryError {
+			t.Errorf("got error '%s', wanted '%s'", err, queryError)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
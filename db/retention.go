@@ -0,0 +1,174 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"log"
+	"time"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+// purgeMetrics counts purge runs and the rows they deleted, published at /debug/vars
+var purgeMetrics = expvar.NewMap("purge")
+
+// RetentionPolicy configures how long stored data is kept. A zero duration keeps that data forever.
+type RetentionPolicy struct {
+	// ListedResults is how long listed results are kept after their last check
+	ListedResults time.Duration
+	// CleanResults is how long all other results, i.e. clean IPs and failed lookups, are kept
+	// after their last check
+	CleanResults time.Duration
+	// History is how long checks are kept in the lookup history
+	History time.Duration
+	// Events is how long listing events are kept
+	Events time.Duration
+	// Jobs is how long finished jobs and their items are kept
+	Jobs time.Duration
+}
+
+// cutoff returns the time before which data is deleted. A zero cutoff matches no data.
+func cutoff(now time.Time, retention time.Duration) time.Time {
+	if retention <= 0 {
+		return time.Time{}
+	}
+	return dbTime(now.Add(-retention))
+}
+
+// Purge deletes the data that is older than the retention policy allows and returns the number
+// of rows deleted of each kind
+func Purge(db *sql.DB, policy RetentionPolicy, now time.Time) (*model.PurgeResult, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	results, err := execCount(tx, `
+	DELETE FROM address_results
+	WHERE (status = $1 AND updated_at < $2)
+	OR (status != $1 AND updated_at < $3)
+	`, model.LookupStatusListed, cutoff(now, policy.ListedResults), cutoff(now, policy.CleanResults))
+	if err != nil {
+		return nil, err
+	}
+
+	// The last conclusive check of each IP and zone is kept, so that the next check is still
+	// compared with it to detect listing events
+	history, err := execCount(tx, `
+	DELETE FROM lookup_history
+	WHERE checked_at < $1
+	AND id NOT IN (
+		SELECT MAX(id) FROM lookup_history WHERE status IN ($2, $3) GROUP BY ip_address, zone
+	)
+	`, cutoff(now, policy.History), model.LookupStatusListed, model.LookupStatusNotListed)
+	if err != nil {
+		return nil, err
+	}
+
+	events, err := execCount(tx, `DELETE FROM listing_events WHERE created_at < $1`, cutoff(now, policy.Events))
+	if err != nil {
+		return nil, err
+	}
+
+	// Jobs with items that are still waiting to be looked up are kept regardless of their age
+	jobsBefore := cutoff(now, policy.Jobs)
+	_, err = tx.Exec(`
+	DELETE FROM job_items
+	WHERE job_id IN (
+		SELECT id FROM jobs
+		WHERE created_at < $1
+		AND id NOT IN (SELECT job_id FROM job_items WHERE state IN ($2, $3))
+	)
+	`, jobsBefore, model.JobItemStatePending, model.JobItemStateProcessing)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err := execCount(tx, `
+	DELETE FROM jobs
+	WHERE created_at < $1
+	AND id NOT IN (SELECT job_id FROM job_items)
+	`, jobsBefore)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.PurgeResult{
+		Results: results,
+		History: history,
+		Events:  events,
+		Jobs:    jobs,
+	}, tx.Commit()
+}
+
+// execCount runs a statement and returns the number of rows it affected
+func execCount(tx *sql.Tx, query string, args ...interface{}) (int, error) {
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+// Purger deletes stored data that is older than the retention policy, both periodically and on
+// demand, and keeps track of the rows it deleted
+type Purger struct {
+	store    Store
+	policy   RetentionPolicy
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewPurger creates a purger that deletes data older than the policy allows every interval
+func NewPurger(store Store, policy RetentionPolicy, interval time.Duration) *Purger {
+	return &Purger{
+		store:    store,
+		policy:   policy,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Start runs the purger in the background until the context is cancelled
+func (p *Purger) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, err := p.Purge()
+				if err != nil {
+					log.Printf("error occurred while purging expired data: %s\n", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// Purge deletes the data that is older than the retention policy allows and returns the number
+// of rows deleted of each kind
+func (p *Purger) Purge() (*model.PurgeResult, error) {
+	purgeMetrics.Add("runs", 1)
+
+	result, err := p.store.Purge(p.policy, p.now())
+	if err != nil {
+		purgeMetrics.Add("failures", 1)
+		return nil, err
+	}
+
+	purgeMetrics.Add("deleted_results", int64(result.Results))
+	purgeMetrics.Add("deleted_history", int64(result.History))
+	purgeMetrics.Add("deleted_events", int64(result.Events))
+	purgeMetrics.Add("deleted_jobs", int64(result.Jobs))
+
+	log.Printf("purged %d result(s), %d history entries, %d event(s) and %d job(s)", result.Results, result.History, result.Events, result.Jobs)
+	return result, nil
+}
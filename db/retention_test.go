@@ -0,0 +1,124 @@
+package db
+
+import (
+	"errors"
+	"expvar"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestPurge(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	now := time.Date(2021, 3, 31, 7, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+
+	t.Run("should delete data older than policy", func(t *testing.T) {
+		policy := RetentionPolicy{ListedResults: 24 * time.Hour, CleanResults: time.Hour, History: 2 * time.Hour, Jobs: 3 * time.Hour}
+
+		mock.ExpectBegin()
+		mock.
+			ExpectExec(`DELETE FROM address_results(.+)`).
+			WithArgs(
+				model.LookupStatusListed,
+				time.Date(2021, 3, 30, 12, 0, 0, 0, time.UTC),
+				time.Date(2021, 3, 31, 11, 0, 0, 0, time.UTC),
+			).
+			WillReturnResult(sqlmock.NewResult(0, 5))
+		mock.
+			ExpectExec(`DELETE FROM lookup_history(.+)`).
+			WithArgs(time.Date(2021, 3, 31, 10, 0, 0, 0, time.UTC), model.LookupStatusListed, model.LookupStatusNotListed).
+			WillReturnResult(sqlmock.NewResult(0, 40))
+		// Events are kept forever, so no event is old enough
+		mock.
+			ExpectExec(`DELETE FROM listing_events(.+)`).
+			WithArgs(time.Time{}).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.
+			ExpectExec(`DELETE FROM job_items(.+)`).
+			WithArgs(time.Date(2021, 3, 31, 9, 0, 0, 0, time.UTC), model.JobItemStatePending, model.JobItemStateProcessing).
+			WillReturnResult(sqlmock.NewResult(0, 6))
+		mock.
+			ExpectExec(`DELETE FROM jobs(.+)`).
+			WithArgs(time.Date(2021, 3, 31, 9, 0, 0, 0, time.UTC)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		result, err := Purge(db, policy, now)
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		want := model.PurgeResult{Results: 5, History: 40, Events: 0, Jobs: 2}
+		if *result != want {
+			t.Errorf("got %v, want %v", result, want)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should return error and roll back if delete fails", func(t *testing.T) {
+		deleteError := errors.New("unable to delete")
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM address_results(.+)`).WillReturnError(deleteError)
+		mock.ExpectRollback()
+
+		_, err := Purge(db, RetentionPolicy{}, now)
+		if err != deleteError {
+			t.Errorf("got error '%s', wanted '%s'", err, deleteError)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+func TestPurger(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	t.Run("should count deleted rows", func(t *testing.T) {
+		before := purgeMetrics.Get("deleted_history")
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM address_results(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM lookup_history(.+)`).WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`DELETE FROM listing_events(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM job_items(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM jobs(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		purger := NewPurger(NewSQLiteStore(db), RetentionPolicy{History: time.Hour}, time.Hour)
+		_, err := purger.Purge()
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		deleted := purgeMetrics.Get("deleted_history").(*expvar.Int).Value()
+		if before != nil {
+			deleted -= before.(*expvar.Int).Value()
+		}
+		if deleted != 3 {
+			t.Errorf("got %d deleted history entries counted, want 3", deleted)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"net"
+	"time"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+// legacyZone is the zone that every result of the first version of the application was checked against
+const legacyZone = "spamhaus-zen"
+
+// SQLiteStore stores data in a SQLite database. SQLite only supports a single writer, so it
+// cannot be shared by several replicas of the application.
+type SQLiteStore struct {
+	sqlStore
+}
+
+// NewSQLiteStore creates a store on top of an open SQLite database
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{sqlStore{db: db, driver: DriverSQLite}}
+}
+
+func (s *SQLiteStore) ClaimJobItems(owner string, limit int) ([]JobItem, error) {
+	return ClaimJobItems(s.db, owner, limit)
+}
+
+// legacyResult is a lookup result as stored by the first version of the application, which only
+// checked zen.spamhaus.org and kept a single result per IP
+type legacyResult struct {
+	uuid         string
+	ipAddress    string
+	responseCode sql.NullString
+	createdAt    sql.NullString
+	updatedAt    sql.NullString
+}
+
+// rebuildLegacyResults rebuilds the address_results table of databases set up by the first version
+// of the application, which predates zones, so that the initial migration finds the current layout.
+// Databases in any other state are left alone.
+func rebuildLegacyResults(tx *sql.Tx) error {
+	// The table has no columns if it does not exist
+	var columns, zoneColumns int
+	err := tx.QueryRow(`
+	SELECT COUNT(*), COUNT(CASE WHEN name = 'zone' THEN 1 END)
+	FROM pragma_table_info('address_results')
+	`).Scan(&columns, &zoneColumns)
+	if err != nil {
+		return err
+	}
+	if columns == 0 || zoneColumns > 0 {
+		return nil
+	}
+
+	rows, err := tx.Query(`SELECT uuid, ip_address, response_code, created_at, updated_at FROM address_results`)
+	if err != nil {
+		return err
+	}
+	legacyResults := []legacyResult{}
+	for rows.Next() {
+		result := legacyResult{}
+		err = rows.Scan(&result.uuid, &result.ipAddress, &result.responseCode, &result.createdAt, &result.updatedAt)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		legacyResults = append(legacyResults, result)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE TABLE address_results_rebuilt
+	(
+		uuid TEXT UNIQUE,
+		response_code TEXT,
+		ip_address TEXT,
+		ip_bytes BLOB,
+		zone TEXT,
+		status TEXT,
+		error_class TEXT,
+		reason TEXT,
+		created_at TIMESTAMP,
+		updated_at TIMESTAMP,
+		PRIMARY KEY (ip_address, zone)
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	now := dbTime(time.Now())
+	for _, result := range legacyResults {
+		ip := net.ParseIP(result.ipAddress)
+		if ip == nil {
+			continue
+		}
+
+		// Only IPs listed by the zone were stored, always along with the response code
+		status := model.LookupStatusNotListed
+		var responseCode *string
+		if result.responseCode.String != "" {
+			status = model.LookupStatusListed
+			responseCode = &result.responseCode.String
+		}
+
+		_, err = tx.Exec(`
+		INSERT INTO address_results_rebuilt (uuid, ip_address, zone, status, response_code, created_at, updated_at, ip_bytes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, result.uuid, ip.String(), legacyZone, status, responseCode,
+			parseLegacyTime(result.createdAt.String, now), parseLegacyTime(result.updatedAt.String, now), ipBytes(ip))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`DROP TABLE address_results`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`ALTER TABLE address_results_rebuilt RENAME TO address_results`)
+	return err
+}
+
+// parseLegacyTime parses a timestamp stored as RFC 3339 text, falling back to the given time
+func parseLegacyTime(value string, fallback time.Time) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return fallback
+	}
+	return dbTime(parsed)
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+// Error definitions
+var ErrorUnknownDriver error = errors.New("unknown database driver")
+
+// Supported database drivers
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
+// Store persists lookup results along with their history and listing events, and the jobs of
+// enqueued IPs
+type Store interface {
+	// Migrate applies every pending migration to the schema and returns the number applied
+	Migrate() (int, error)
+	// Migrations reports whether each migration was applied to the schema
+	Migrations() ([]*MigrationState, error)
+	// Close closes the connection to the database
+	Close() error
+
+	// GetIPLookupResults gets the lookup results of an IP, one per zone
+	GetIPLookupResults(ip net.IP) ([]*model.IPLookupResult, error)
+	// GetIPLookupResultsBatch gets the lookup results of many IPs, grouped by IP
+	GetIPLookupResultsBatch(ips []net.IP) (map[string][]*model.IPLookupResult, error)
+	// UpsertIPLookupResult stores a lookup result along with its history and listing events
+	UpsertIPLookupResult(result model.IPLookupResult) error
+	// GetLookupResults gets a page of the stored lookup results matching the filter
+	GetLookupResults(first int, after *string, filter *model.LookupResultFilter) (*model.LookupResultConnection, error)
+	// GetNetworkResults gets every stored lookup result of the IPs inside a network of at most
+	// maxRangeBits host bits
+	GetNetworkResults(cidr string, maxRangeBits int) (*model.NetworkResults, error)
+	// GetLookupHistory gets a page of the checks of an IP against a zone, most recent first
+	GetLookupHistory(ip net.IP, zone string, first int, after *string) (*model.LookupHistoryConnection, error)
+	// GetListingEvents gets the listing events that occurred at or after the given time
+	GetListingEvents(since time.Time) ([]*model.ListingEvent, error)
+
+	// CreateJob stores a job with a pending item for each IP
+	CreateJob(ips []string) (string, error)
+	// GetJob gets a job along with the number of its items in each state
+	GetJob(id string) (*model.Job, error)
+	// GetJobItems gets the items of a job, optionally only those in the given state
+	GetJobItems(jobID string, state *model.JobItemState) ([]*model.JobItem, error)
+	// ClaimJobItems marks up to limit pending job items as processing by the owner and returns them
+	ClaimJobItems(owner string, limit int) ([]JobItem, error)
+	// CompleteJobItem marks a job item as done, or as failed if an error is given
+	CompleteJobItem(id int64, itemErr error) error
+	// RenewJobItems refreshes the owner's claim on the job items it is processing
+	RenewJobItems(owner string) (int64, error)
+	// ResetJobItems returns job items whose claim was last refreshed before the given time to
+	// the pending state
+	ResetJobItems(claimedBefore time.Time) (int64, error)
+	// GetStaleIPs gets up to limit IPs whose results are due to be checked again
+	GetStaleIPs(listedBefore time.Time, cleanBefore time.Time, limit int) ([]string, error)
+
+	// Purge deletes the data that is older than the retention policy allows
+	Purge(policy RetentionPolicy, now time.Time) (*model.PurgeResult, error)
+}
+
+// Open connects to the database of the given driver and returns its store
+func Open(driver string, datasource string) (Store, error) {
+	switch driver {
+	case DriverSQLite:
+		database, err := Connect(datasource)
+		if err != nil {
+			return nil, err
+		}
+		return NewSQLiteStore(database), nil
+	case DriverPostgres:
+		database, err := sql.Open(DriverPostgres, datasource)
+		if err != nil {
+			return nil, err
+		}
+		return NewPostgresStore(database), nil
+	default:
+		return nil, ErrorUnknownDriver
+	}
+}
+
+// sqlStore implements the operations that both supported databases run with the same queries
+type sqlStore struct {
+	db *sql.DB
+	// driver names the directory of the store's migrations
+	driver string
+	// migrationLock is run before each migration, if set
+	migrationLock string
+}
+
+func (s *sqlStore) Migrate() (int, error) {
+	migrations, err := loadMigrations(s.driver)
+	if err != nil {
+		return 0, err
+	}
+	return migrate(s.db, migrations, s.migrationLock)
+}
+
+func (s *sqlStore) Migrations() ([]*MigrationState, error) {
+	migrations, err := loadMigrations(s.driver)
+	if err != nil {
+		return nil, err
+	}
+	return migrationStates(s.db, migrations)
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqlStore) GetIPLookupResults(ip net.IP) ([]*model.IPLookupResult, error) {
+	return GetIPLookupResults(s.db, ip)
+}
+
+func (s *sqlStore) GetIPLookupResultsBatch(ips []net.IP) (map[string][]*model.IPLookupResult, error) {
+	return GetIPLookupResultsBatch(s.db, ips)
+}
+
+func (s *sqlStore) UpsertIPLookupResult(result model.IPLookupResult) error {
+	return UpsertIPLookupResult(s.db, result)
+}
+
+func (s *sqlStore) GetLookupResults(first int, after *string, filter *model.LookupResultFilter) (*model.LookupResultConnection, error) {
+	return GetLookupResults(s.db, first, after, filter)
+}
+
+func (s *sqlStore) GetNetworkResults(cidr string, maxRangeBits int) (*model.NetworkResults, error) {
+	return GetNetworkResults(s.db, cidr, maxRangeBits)
+}
+
+func (s *sqlStore) GetLookupHistory(ip net.IP, zone string, first int, after *string) (*model.LookupHistoryConnection, error) {
+	return GetLookupHistory(s.db, ip, zone, first, after)
+}
+
+func (s *sqlStore) GetListingEvents(since time.Time) ([]*model.ListingEvent, error) {
+	return GetListingEvents(s.db, since)
+}
+
+func (s *sqlStore) CreateJob(ips []string) (string, error) {
+	return CreateJob(s.db, ips)
+}
+
+func (s *sqlStore) GetJob(id string) (*model.Job, error) {
+	return GetJob(s.db, id)
+}
+
+func (s *sqlStore) GetJobItems(jobID string, state *model.JobItemState) ([]*model.JobItem, error) {
+	return GetJobItems(s.db, jobID, state)
+}
+
+func (s *sqlStore) CompleteJobItem(id int64, itemErr error) error {
+	return CompleteJobItem(s.db, id, itemErr)
+}
+
+func (s *sqlStore) RenewJobItems(owner string) (int64, error) {
+	return RenewJobItems(s.db, owner)
+}
+
+func (s *sqlStore) ResetJobItems(claimedBefore time.Time) (int64, error) {
+	return ResetJobItems(s.db, claimedBefore)
+}
+
+func (s *sqlStore) GetStaleIPs(listedBefore time.Time, cleanBefore time.Time, limit int) ([]string, error) {
+	return GetStaleIPs(s.db, listedBefore, cleanBefore, limit)
+}
+
+func (s *sqlStore) Purge(policy RetentionPolicy, now time.Time) (*model.PurgeResult, error) {
+	return Purge(s.db, policy, now)
+}
@@ -0,0 +1,88 @@
+package dns
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+// SubscriberBufferSize is the number of stored results buffered for each subscriber. Results
+// stored while a subscriber's buffer is full are dropped for that subscriber, so slow
+// subscribers never hold up the workers.
+const SubscriberBufferSize = 100
+
+// subscriber receives the stored results matching its job ID and IPs
+type subscriber struct {
+	jobID   string
+	ips     map[string]bool
+	results chan *model.IPLookupResult
+}
+
+// ResultBroker publishes the lookup results stored by the workers to in-process subscribers
+type ResultBroker struct {
+	mu          sync.Mutex
+	subscribers map[*subscriber]bool
+}
+
+// NewResultBroker creates a broker without any subscribers
+func NewResultBroker() *ResultBroker {
+	return &ResultBroker{subscribers: map[*subscriber]bool{}}
+}
+
+// Subscribe returns a channel receiving every stored result of the given job and IPs. An empty
+// job ID matches every job and no IPs match every IP. The channel is closed once the context
+// is cancelled.
+func (b *ResultBroker) Subscribe(ctx context.Context, jobID string, ips []net.IP) <-chan *model.IPLookupResult {
+	sub := &subscriber{
+		jobID:   jobID,
+		results: make(chan *model.IPLookupResult, SubscriberBufferSize),
+	}
+	if len(ips) > 0 {
+		sub.ips = map[string]bool{}
+		for _, ip := range ips {
+			sub.ips[ip.String()] = true
+		}
+	}
+
+	b.mu.Lock()
+	b.subscribers[sub] = true
+	b.mu.Unlock()
+
+	// Unsubscribe once the subscriber goes away. The channel is closed while holding the lock,
+	// so nothing is published to it afterwards
+	go func() {
+		<-ctx.Done()
+
+		b.mu.Lock()
+		delete(b.subscribers, sub)
+		close(sub.results)
+		b.mu.Unlock()
+	}()
+
+	return sub.results
+}
+
+// Publish sends a stored result of the given job to every matching subscriber
+func (b *ResultBroker) Publish(jobID string, result model.IPLookupResult) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subscribers {
+		if sub.jobID != "" && sub.jobID != jobID {
+			continue
+		}
+		if sub.ips != nil && !sub.ips[result.IPAddress.String()] {
+			continue
+		}
+
+		published := result
+		select {
+		case sub.results <- &published:
+		default:
+			log.Printf("dropped %s result for IP %s for a slow subscriber", result.Zone, result.IPAddress)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestResultBroker(t *testing.T) {
+	tests := []struct {
+		description string
+		jobID       string
+		ips         []net.IP
+		want        []string
+	}{
+		{
+			description: "should receive every result without filters",
+			want:        []string{"1.2.3.4", "5.6.7.8", "2001:db8::1"},
+		},
+		{
+			description: "should receive results of the job",
+			jobID:       "job-1",
+			want:        []string{"1.2.3.4", "5.6.7.8"},
+		},
+		{
+			description: "should receive results of the IPs",
+			ips:         []net.IP{net.ParseIP("2001:0db8::1"), net.ParseIP("1.2.3.4")},
+			want:        []string{"1.2.3.4", "2001:db8::1"},
+		},
+		{
+			description: "should receive results of the IPs of the job",
+			jobID:       "job-1",
+			ips:         []net.IP{net.ParseIP("5.6.7.8")},
+			want:        []string{"5.6.7.8"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			broker := NewResultBroker()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			results := broker.Subscribe(ctx, test.jobID, test.ips)
+
+			broker.Publish("job-1", model.IPLookupResult{IPAddress: net.ParseIP("1.2.3.4")})
+			broker.Publish("job-1", model.IPLookupResult{IPAddress: net.ParseIP("5.6.7.8")})
+			broker.Publish("job-2", model.IPLookupResult{IPAddress: net.ParseIP("2001:db8::1")})
+
+			got := []string{}
+			for len(results) > 0 {
+				got = append(got, (<-results).IPAddress.String())
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("got %v, want %v", got, test.want)
+				}
+			}
+		})
+	}
+
+	t.Run("should drop results for a full subscriber", func(t *testing.T) {
+		broker := NewResultBroker()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		results := broker.Subscribe(ctx, "", nil)
+
+		for i := 0; i < SubscriberBufferSize+1; i++ {
+			broker.Publish("job", model.IPLookupResult{IPAddress: net.ParseIP("1.2.3.4")})
+		}
+
+		if len(results) != SubscriberBufferSize {
+			t.Errorf("got %d buffered results, want %d", len(results), SubscriberBufferSize)
+		}
+	})
+
+	t.Run("should close channel once the context is cancelled", func(t *testing.T) {
+		broker := NewResultBroker()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		results := broker.Subscribe(ctx, "", nil)
+		cancel()
+
+		select {
+		case _, ok := <-results:
+			if ok {
+				t.Error("got result, want closed channel")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("channel was not closed")
+		}
+
+		// Publishing after unsubscribing must not panic
+		broker.Publish("job", model.IPLookupResult{IPAddress: net.ParseIP("1.2.3.4")})
+	})
+}
@@ -0,0 +1,91 @@
+package dns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/grantsavage/ip-lookup-api/db"
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+// ReturnCodeTable maps the response codes of a zone to the listing they represent
+type ReturnCodeTable map[string]model.Listing
+
+// spamhausZenCodes decodes the response codes returned by zen.spamhaus.org
+var spamhausZenCodes = ReturnCodeTable{
+	"127.0.0.2":  {Name: "SBL", Description: "Spamhaus SBL: direct spam sources and spam operations", Severity: model.SeverityHigh},
+	"127.0.0.3":  {Name: "CSS", Description: "Spamhaus CSS: low reputation hosts sending snowshoe spam", Severity: model.SeverityMedium},
+	"127.0.0.4":  {Name: "XBL", Description: "Spamhaus XBL: hosts infected with exploits or malware", Severity: model.SeverityHigh},
+	"127.0.0.5":  {Name: "XBL", Description: "Spamhaus XBL: hosts infected with exploits or malware", Severity: model.SeverityHigh},
+	"127.0.0.6":  {Name: "XBL", Description: "Spamhaus XBL: hosts infected with exploits or malware", Severity: model.SeverityHigh},
+	"127.0.0.7":  {Name: "XBL", Description: "Spamhaus XBL: hosts infected with exploits or malware", Severity: model.SeverityHigh},
+	"127.0.0.9":  {Name: "DROP", Description: "Spamhaus DROP/EDROP: hijacked netblocks and networks run by criminals", Severity: model.SeverityCritical},
+	"127.0.0.10": {Name: "PBL", Description: "Spamhaus PBL: end-user address range listed by the ISP", Severity: model.SeverityLow},
+	"127.0.0.11": {Name: "PBL", Description: "Spamhaus PBL: end-user address range listed by Spamhaus", Severity: model.SeverityLow},
+}
+
+// spamcopCodes decodes the response codes returned by bl.spamcop.net
+var spamcopCodes = ReturnCodeTable{
+	"127.0.0.2": {Name: "SCBL", Description: "SpamCop: host reported as a source of spam", Severity: model.SeverityMedium},
+}
+
+// barracudaCodes decodes the response codes returned by b.barracudacentral.org
+var barracudaCodes = ReturnCodeTable{
+	"127.0.0.2": {Name: "BRBL", Description: "Barracuda: host with a poor sending reputation", Severity: model.SeverityMedium},
+}
+
+// sorbsCodes decodes the response codes returned by dnsbl.sorbs.net
+var sorbsCodes = ReturnCodeTable{
+	"127.0.0.2":  {Name: "HTTP", Description: "SORBS: open HTTP proxy", Severity: model.SeverityHigh},
+	"127.0.0.3":  {Name: "SOCKS", Description: "SORBS: open SOCKS proxy", Severity: model.SeverityHigh},
+	"127.0.0.4":  {Name: "MISC", Description: "SORBS: other open proxy", Severity: model.SeverityHigh},
+	"127.0.0.5":  {Name: "SMTP", Description: "SORBS: open SMTP relay", Severity: model.SeverityHigh},
+	"127.0.0.6":  {Name: "SPAM", Description: "SORBS: host has sent spam to SORBS spam traps", Severity: model.SeverityMedium},
+	"127.0.0.7":  {Name: "WEB", Description: "SORBS: web server with vulnerabilities abused by spammers", Severity: model.SeverityMedium},
+	"127.0.0.8":  {Name: "BLOCK", Description: "SORBS: network owner requested not to be tested", Severity: model.SeverityLow},
+	"127.0.0.9":  {Name: "ZOMBIE", Description: "SORBS: hijacked network", Severity: model.SeverityCritical},
+	"127.0.0.10": {Name: "DUL", Description: "SORBS: dynamic IP address range", Severity: model.SeverityLow},
+	"127.0.0.11": {Name: "BADCONF", Description: "SORBS: domain with misconfigured DNS records", Severity: model.SeverityLow},
+	"127.0.0.12": {Name: "NOMAIL", Description: "SORBS: domain owner states it sends no mail", Severity: model.SeverityLow},
+	"127.0.0.14": {Name: "NOSERVER", Description: "SORBS: network owner states it runs no servers", Severity: model.SeverityLow},
+}
+
+// ReturnCodeTables holds the built-in return code tables keyed by zone suffix
+var ReturnCodeTables = map[string]ReturnCodeTable{
+	"zen.spamhaus.org":       spamhausZenCodes,
+	"bl.spamcop.net":         spamcopCodes,
+	"b.barracudacentral.org": barracudaCodes,
+	"dnsbl.sorbs.net":        sorbsCodes,
+}
+
+// DecodeResponseCode decodes the response codes returned by the zone into the listing each one
+// represents, in the order they are stored
+func DecodeResponseCode(zone Zone, responseCode string) []*model.Listing {
+	listings := []*model.Listing{}
+
+	// A result without a response code is not listed
+	if responseCode == "" {
+		return listings
+	}
+
+	// Use the zone's own table if configured, otherwise fall back to the built-in table
+	table := zone.ReturnCodes
+	if table == nil {
+		table = ReturnCodeTables[zone.Suffix]
+	}
+
+	for _, code := range strings.Split(responseCode, db.ResponseCodeSeparator) {
+		listing, ok := table[code]
+		if !ok {
+			// The IP is still listed even though we do not know why
+			listing = model.Listing{
+				Name:        "UNKNOWN",
+				Description: fmt.Sprintf("listed by %s with unrecognised response code %s", zone.Name, code),
+				Severity:    model.SeverityMedium,
+			}
+		}
+		listings = append(listings, &listing)
+	}
+
+	return listings
+}
@@ -0,0 +1,103 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestDecodeResponseCode(t *testing.T) {
+	type input struct {
+		zone         Zone
+		responseCode string
+	}
+	type want struct {
+		listings []model.Listing
+	}
+
+	tests := []struct {
+		description string
+		input       input
+		want        want
+	}{
+		{
+			description: "should decode Spamhaus SBL listing",
+			input: input{
+				zone:         DefaultZones[0],
+				responseCode: "127.0.0.2",
+			},
+			want: want{
+				listings: []model.Listing{spamhausZenCodes["127.0.0.2"]},
+			},
+		},
+		{
+			description: "should decode Spamhaus PBL listing",
+			input: input{
+				zone:         DefaultZones[0],
+				responseCode: "127.0.0.10",
+			},
+			want: want{
+				listings: []model.Listing{{Name: "PBL", Description: spamhausZenCodes["127.0.0.10"].Description, Severity: model.SeverityLow}},
+			},
+		},
+		{
+			description: "should decode every response code",
+			input: input{
+				zone:         DefaultZones[0],
+				responseCode: "127.0.0.4,127.0.0.10",
+			},
+			want: want{
+				listings: []model.Listing{spamhausZenCodes["127.0.0.4"], spamhausZenCodes["127.0.0.10"]},
+			},
+		},
+		{
+			description: "should decode with the zone's own table",
+			input: input{
+				zone: Zone{
+					Name:        "internal",
+					Suffix:      "bl.example.com",
+					ReturnCodes: ReturnCodeTable{"127.0.0.2": {Name: "INTERNAL", Description: "internal", Severity: model.SeverityCritical}},
+				},
+				responseCode: "127.0.0.2",
+			},
+			want: want{
+				listings: []model.Listing{{Name: "INTERNAL", Description: "internal", Severity: model.SeverityCritical}},
+			},
+		},
+		{
+			description: "should return unknown listing for unrecognised response code",
+			input: input{
+				zone:         Zone{Name: "internal", Suffix: "bl.example.com"},
+				responseCode: "127.0.0.2",
+			},
+			want: want{
+				listings: []model.Listing{{Name: "UNKNOWN", Description: "listed by internal with unrecognised response code 127.0.0.2", Severity: model.SeverityMedium}},
+			},
+		},
+		{
+			description: "should return no listings without a response code",
+			input: input{
+				zone: DefaultZones[0],
+			},
+			want: want{
+				listings: []model.Listing{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := DecodeResponseCode(test.input.zone, test.input.responseCode)
+
+			// Check listings
+			if len(got) != len(test.want.listings) {
+				t.Fatalf("got %d listings, want %d", len(got), len(test.want.listings))
+			}
+			for i, listing := range got {
+				if *listing != test.want.listings[i] {
+					t.Errorf("got %v, want %v", *listing, test.want.listings[i])
+				}
+			}
+		})
+	}
+}
@@ -1,12 +1,15 @@
 package dns
 
 import (
-	"database/sql"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"net"
 	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/grantsavage/ip-lookup-api/db"
@@ -15,22 +18,47 @@ import (
 )
 
 // HostLookupFunc is a function interface for performing the host lookup
-type HostLookupFunc func(string) ([]string, error)
+type HostLookupFunc func(ctx context.Context, host string) ([]string, error)
+
+// TXTLookupFunc is a function interface for performing the TXT record lookup
+type TXTLookupFunc func(ctx context.Context, name string) ([]string, error)
+
+// LookupConfig configures how the blocklist worker performs lookups
+type LookupConfig struct {
+	// LookupFunc performs the host lookup, e.g. net.Resolver.LookupHost
+	LookupFunc HostLookupFunc
+	// TXTLookupFunc fetches the reason for each listing, e.g. net.Resolver.LookupTXT. If nil, reasons are not fetched
+	TXTLookupFunc TXTLookupFunc
+	// QueryTimeout bounds each individual zone query. Zero means no timeout
+	QueryTimeout time.Duration
+	// JobTimeout bounds the time between enqueueing a list of IPs and finishing their lookups. Zero means no timeout
+	JobTimeout time.Duration
+	// Health tracks zones that refuse queries. May be nil
+	Health *HealthTracker
+	// Broker publishes every stored result to subscribers. May be nil
+	Broker *ResultBroker
+}
 
 // Error definitions
 var ErrorNoResponse = errors.New("no response from address lookup")
 var ErrorUnexpectedResponse = errors.New("response did not match expected response code")
+var ErrorNotListed = errors.New("IP is not listed by the zone")
 
 // Regular expression for validating response codes
 var ExpectedResponsePattern = regexp.MustCompile("^127.0.0.*")
 
-// LookupIP looks up the target IP against the DNSBL address
-func LookupIP(targetIP net.IP, dnsblAddress string, lookupFunc HostLookupFunc) (net.IP, error) {
-	// Create lookup address from target IP and DNSBL address
-	lookup := fmt.Sprintf("%s.%s", targetIP.String(), dnsblAddress)
+// LookupIP looks up the reversed target IP against the DNSBL zone and returns every response
+// code the zone answered with, in ascending order
+func LookupIP(ctx context.Context, reversedIP string, zone Zone, lookupFunc HostLookupFunc) ([]net.IP, error) {
+	// Create lookup address from reversed target IP and zone suffix
+	lookup := fmt.Sprintf("%s.%s", reversedIP, zone.Suffix)
 
-	// Perform lookup
-	response, err := lookupFunc(lookup)
+	// Perform lookup. Zones answer with NXDOMAIN for IPs they do not list
+	response, err := lookupFunc(ctx, lookup)
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) && dnsError.IsNotFound {
+		return nil, ErrorNotListed
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -40,60 +68,206 @@ func LookupIP(targetIP net.IP, dnsblAddress string, lookupFunc HostLookupFunc) (
 		return nil, ErrorNoResponse
 	}
 
-	// We want just the first result from the response
-	ip := response[0]
-	match := ExpectedResponsePattern.MatchString(ip)
+	// Use the default pattern if the zone does not specify one
+	pattern := zone.ExpectedResponsePattern
+	if pattern == nil {
+		pattern = ExpectedResponsePattern
+	}
+
+	// Zones answer with a record for each list the IP is on, in no particular order
+	codes := []net.IP{}
+	seen := map[string]bool{}
+	for _, record := range response {
+		// Zones report refused queries with error codes which must not be mistaken for listings
+		err = checkZoneError(zone, record)
+		if err != nil {
+			return nil, err
+		}
 
-	// Check if response is valid
-	if !match {
-		return nil, ErrorUnexpectedResponse
+		// Check if response is valid
+		code := net.ParseIP(record)
+		if code == nil || !pattern.MatchString(record) {
+			return nil, ErrorUnexpectedResponse
+		}
+
+		if seen[code.String()] {
+			continue
+		}
+		seen[code.String()] = true
+		codes = append(codes, code)
 	}
 
-	return net.ParseIP(ip), nil
+	sort.Slice(codes, func(i, j int) bool {
+		return bytes.Compare(codes[i].To16(), codes[j].To16()) < 0
+	})
+
+	return codes, nil
 }
 
-// SearchIPBlocklist normalizes the given IP and performs the blocklist lookup
-func SearchIPBlocklist(ipAddress net.IP, lookupFunc HostLookupFunc) (net.IP, error) {
+// joinResponseCodes formats response codes as they are stored, e.g. 127.0.0.4,127.0.0.10
+func joinResponseCodes(codes []net.IP) string {
+	formatted := []string{}
+	for _, code := range codes {
+		formatted = append(formatted, code.String())
+	}
+	return strings.Join(formatted, db.ResponseCodeSeparator)
+}
+
+// SearchIPBlocklist normalizes the given IP and performs the blocklist lookup against the zone
+func SearchIPBlocklist(ctx context.Context, ipAddress net.IP, zone Zone, lookupFunc HostLookupFunc) ([]net.IP, error) {
 	// Reverse the IP
 	reversedIp := ReverseIP(ipAddress)
 
 	// Lookup the IP
-	responseCode, err := LookupIP(reversedIp, "zen.spamhaus.org", lookupFunc)
+	responseCodes, err := LookupIP(ctx, reversedIp, zone, lookupFunc)
 	if err != nil {
 		return nil, err
 	}
 
-	return responseCode, err
+	return responseCodes, err
 }
 
-// BlocklistWorker loops over a list of IPs and additionally stores the lookup results.
-func BlocklistWorker(database *sql.DB, ips []net.IP) {
-	// Kick off a background task to lookup each valid IP
-	for _, ipAddress := range ips {
-		log.Printf("querying blocklist for IP address " + ipAddress.String())
+// LookupReason fetches the TXT record a zone publishes alongside a listing, explaining why the IP is listed
+func LookupReason(ctx context.Context, ipAddress net.IP, zone Zone, lookupFunc TXTLookupFunc) (string, error) {
+	// TXT records are published under the same name as the listing's A record
+	lookup := fmt.Sprintf("%s.%s", ReverseIP(ipAddress), zone.Suffix)
 
-		// Search IP blocklist and get response code
-		responseCode, err := SearchIPBlocklist(ipAddress, net.LookupHost)
-		if err != nil {
-			log.Printf("error occurred while searching IP blocklist: %s\n", err.Error())
+	records, err := lookupFunc(ctx, lookup)
+	if err != nil {
+		return "", err
+	}
+
+	// Check the response length
+	if len(records) == 0 {
+		return "", ErrorNoResponse
+	}
+
+	return strings.Join(records, "; "), nil
+}
+
+// reasonWithTimeout fetches the reason for the listing, bounded by the configured query timeout.
+// A missing reason does not invalidate the listing, so failures are only logged.
+func reasonWithTimeout(ctx context.Context, config LookupConfig, ipAddress net.IP, zone Zone) *string {
+	if config.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.QueryTimeout)
+		defer cancel()
+	}
+
+	reason, err := LookupReason(ctx, ipAddress, zone, config.TXTLookupFunc)
+	if err != nil {
+		log.Printf("error occurred while fetching %s listing reason for IP %s: %s\n", zone.Name, ipAddress, err.Error())
+		return nil
+	}
+
+	return &reason
+}
+
+// searchWithTimeout searches the zone for the IP, bounded by the configured query timeout
+func searchWithTimeout(ctx context.Context, config LookupConfig, ipAddress net.IP, zone Zone) ([]net.IP, error) {
+	if config.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.QueryTimeout)
+		defer cancel()
+	}
+
+	return SearchIPBlocklist(ctx, ipAddress, zone, config.LookupFunc)
+}
+
+// BuildResult builds the lookup result of an IP for a zone from the outcome of the blocklist search
+func BuildResult(ipAddress net.IP, zone Zone, responseCodes []net.IP, err error) model.IPLookupResult {
+	now := time.Now().UTC()
+	result := model.IPLookupResult{
+		UUID:      uuid.NewV4().String(),
+		IPAddress: ipAddress,
+		Zone:      zone.Name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	var zoneError *ZoneError
+	switch {
+	case err == nil:
+		code := joinResponseCodes(responseCodes)
+		result.Status = model.LookupStatusListed
+		result.ResponseCode = &code
+	case errors.Is(err, ErrorNotListed):
+		result.Status = model.LookupStatusNotListed
+	case errors.As(err, &zoneError):
+		// Keep the error code the zone answered with so it can be inspected
+		errorClass := ClassifyError(err)
+		result.Status = model.LookupStatusZoneError
+		result.ResponseCode = &zoneError.ResponseCode
+		result.ErrorClass = &errorClass
+	default:
+		// Record why the lookup failed so it is not mistaken for a clean result
+		errorClass := ClassifyError(err)
+		result.Status = model.LookupStatusError
+		result.ErrorClass = &errorClass
+	}
+
+	return result
+}
+
+// ProcessIP looks up an IP of the given job against every given zone and stores one lookup
+// result per zone. Failed lookups are stored as results, so an error is only returned if a
+// result could not be stored or the lookups were cut short by the context. Lookups cut short
+// by the context are not stored, so they never replace an earlier result.
+func ProcessIP(ctx context.Context, database db.Store, config LookupConfig, zones []Zone, jobID string, ipAddress net.IP) error {
+	var storeErr error
+	for _, zone := range zones {
+		// Stop once the job timed out or the application is shutting down
+		if ctx.Err() != nil {
+			break
+		}
+
+		// Skip zones that cannot list the IP's address family
+		if !zone.Supports(ipAddress) {
 			continue
 		}
 
-		log.Printf("storing result for IP " + ipAddress.String())
+		log.Printf("querying blocklist %s for IP address %s", zone.Name, ipAddress)
+
+		// Search IP blocklist and get response code
+		responseCodes, err := searchWithTimeout(ctx, config, ipAddress, zone)
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil && !errors.Is(err, ErrorNotListed) {
+			log.Printf("error occurred while searching IP blocklist %s: %s\n", zone.Name, err.Error())
+		}
+
+		// Keep track of zones refusing our queries
+		if config.Health != nil {
+			config.Health.Record(zone.Name, err)
+		}
 
 		// Bulid result
-		result := model.IPLookupResult{
-			UUID:         uuid.NewV4().String(),
-			IPAddress:    ipAddress.String(),
-			ResponseCode: responseCode.String(),
-			CreatedAt:    time.Now().Format(time.RFC3339),
-			UpdatedAt:    time.Now().Format(time.RFC3339),
+		result := BuildResult(ipAddress, zone, responseCodes, err)
+
+		// Fetch the reason for the listing if enabled
+		if result.Status == model.LookupStatusListed && config.TXTLookupFunc != nil {
+			result.Reason = reasonWithTimeout(ctx, config, ipAddress, zone)
 		}
 
+		log.Printf("storing %s result for IP %s with status %s", zone.Name, ipAddress, result.Status)
+
 		// Upsert lookup result
-		err = db.UpsertIPLookupResult(database, result)
+		err = database.UpsertIPLookupResult(result)
 		if err != nil {
 			log.Printf("error occurred while storing result: %s\n", err.Error())
+			storeErr = err
+			continue
 		}
+
+		// Let subscribers know the result is available
+		if config.Broker != nil {
+			config.Broker.Publish(jobID, result)
+		}
+	}
+
+	if storeErr != nil {
+		return storeErr
 	}
+	return ctx.Err()
 }
@@ -1,8 +1,15 @@
 package dns
 
 import (
+	"context"
 	"net"
+	"regexp"
 	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/grantsavage/ip-lookup-api/db"
+	"github.com/grantsavage/ip-lookup-api/graph/model"
 )
 
 func TestLookupIP(t *testing.T) {
@@ -31,6 +38,16 @@ func TestLookupIP(t *testing.T) {
 				responseCode: "127.0.0.4",
 			},
 		},
+		{
+			description: "should return every response code in order",
+			input: input{
+				ipAddress: "1.2.3.4",
+				response:  []string{"127.0.0.10", "127.0.0.4", "127.0.0.10"},
+			},
+			want: want{
+				responseCode: "127.0.0.4,127.0.0.10",
+			},
+		},
 		{
 			description: "should return error if lookup failed",
 			input: input{
@@ -41,6 +58,16 @@ func TestLookupIP(t *testing.T) {
 				err: net.ErrClosed,
 			},
 		},
+		{
+			description: "should return not listed error if zone answers with NXDOMAIN",
+			input: input{
+				ipAddress: "1.2.3.4",
+				err:       &net.DNSError{Err: "no such host", IsNotFound: true},
+			},
+			want: want{
+				err: ErrorNotListed,
+			},
+		},
 		{
 			description: "should return error if no response was returned",
 			input: input{
@@ -51,6 +78,36 @@ func TestLookupIP(t *testing.T) {
 				err: ErrorNoResponse,
 			},
 		},
+		{
+			description: "should return zone error if query came from a public resolver",
+			input: input{
+				ipAddress: "1.2.3.4",
+				response:  []string{"127.255.255.254"},
+			},
+			want: want{
+				err: &ZoneError{Zone: "spamhaus-zen", ResponseCode: "127.255.255.254", Err: ErrorZonePublicResolver},
+			},
+		},
+		{
+			description: "should return zone error answered alongside listings",
+			input: input{
+				ipAddress: "1.2.3.4",
+				response:  []string{"127.0.0.4", "127.255.255.254"},
+			},
+			want: want{
+				err: &ZoneError{Zone: "spamhaus-zen", ResponseCode: "127.255.255.254", Err: ErrorZonePublicResolver},
+			},
+		},
+		{
+			description: "should return zone error for unknown error code",
+			input: input{
+				ipAddress: "1.2.3.4",
+				response:  []string{"127.255.255.250"},
+			},
+			want: want{
+				err: &ZoneError{Zone: "spamhaus-zen", ResponseCode: "127.255.255.250", Err: ErrorZoneRefused},
+			},
+		},
 		{
 			description: "should return error if response does not match expected format",
 			input: input{
@@ -65,22 +122,57 @@ func TestLookupIP(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			lookupFunc := func(string) ([]string, error) {
+			lookupFunc := func(context.Context, string) ([]string, error) {
 				return test.input.response, test.input.err
 			}
-			got, err := LookupIP(net.ParseIP(test.input.ipAddress), "zen.spamhaus.org", lookupFunc)
+			got, err := LookupIP(context.Background(), test.input.ipAddress, DefaultZones[0], lookupFunc)
 
 			// Check error condition
 			assertError(t, err, test.want.err)
 
 			// Check response codes
-			if test.want.responseCode != "" && got != nil && test.want.responseCode != got.String() {
-				t.Errorf("got %s, want %s", got, test.want.responseCode)
+			if test.want.responseCode != "" && test.want.responseCode != joinResponseCodes(got) {
+				t.Errorf("got %s, want %s", joinResponseCodes(got), test.want.responseCode)
 			}
 		})
 	}
 }
 
+func TestLookupIPZone(t *testing.T) {
+	t.Run("should query the zone suffix", func(t *testing.T) {
+		zone := Zone{Name: "spamcop", Suffix: "bl.spamcop.net"}
+
+		var got string
+		lookupFunc := func(ctx context.Context, host string) ([]string, error) {
+			got = host
+			return []string{"127.0.0.2"}, nil
+		}
+
+		_, err := LookupIP(context.Background(), "4.3.2.1", zone, lookupFunc)
+		assertError(t, err, nil)
+
+		want := "4.3.2.1.bl.spamcop.net"
+		if got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+	})
+
+	t.Run("should validate response with zone pattern", func(t *testing.T) {
+		zone := Zone{
+			Name:                    "spamcop",
+			Suffix:                  "bl.spamcop.net",
+			ExpectedResponsePattern: regexp.MustCompile(`^127\.0\.0\.2$`),
+		}
+
+		lookupFunc := func(context.Context, string) ([]string, error) {
+			return []string{"127.0.0.4"}, nil
+		}
+
+		_, err := LookupIP(context.Background(), "4.3.2.1", zone, lookupFunc)
+		assertError(t, err, ErrorUnexpectedResponse)
+	})
+}
+
 func TestSearchIPBlocklist(t *testing.T) {
 	type input struct {
 		err       error
@@ -107,6 +199,16 @@ func TestSearchIPBlocklist(t *testing.T) {
 				responseCode: "127.0.0.4",
 			},
 		},
+		{
+			description: "should return response code for IPv6 address",
+			input: input{
+				ipAddress: "2001:db8::1",
+				response:  []string{"127.0.0.2"},
+			},
+			want: want{
+				responseCode: "127.0.0.2",
+			},
+		},
 		{
 			description: "should return error when lookup fails",
 			input: input{
@@ -120,18 +222,327 @@ func TestSearchIPBlocklist(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			lookupFunc := func(string) ([]string, error) {
+			lookupFunc := func(context.Context, string) ([]string, error) {
 				return test.input.response, test.input.err
 			}
-			got, err := SearchIPBlocklist(net.ParseIP(test.input.ipAddress), lookupFunc)
+			got, err := SearchIPBlocklist(context.Background(), net.ParseIP(test.input.ipAddress), DefaultZones[0], lookupFunc)
 
 			// Check error condition
 			assertError(t, err, test.want.err)
 
 			// Check response codes
-			if test.want.responseCode != "" && got != nil && test.want.responseCode != got.String() {
-				t.Errorf("got %s, want %s", got, test.want.responseCode)
+			if test.want.responseCode != "" && test.want.responseCode != joinResponseCodes(got) {
+				t.Errorf("got %s, want %s", joinResponseCodes(got), test.want.responseCode)
 			}
 		})
 	}
 }
+
+func TestLookupReason(t *testing.T) {
+	type input struct {
+		err      error
+		response []string
+	}
+	type want struct {
+		err    error
+		reason string
+	}
+
+	tests := []struct {
+		description string
+		input       input
+		want        want
+	}{
+		{
+			description: "should return TXT record",
+			input: input{
+				response: []string{"Listed by XBL, see https://check.spamhaus.org/query/ip/1.2.3.4"},
+			},
+			want: want{
+				reason: "Listed by XBL, see https://check.spamhaus.org/query/ip/1.2.3.4",
+			},
+		},
+		{
+			description: "should join multiple TXT records",
+			input: input{
+				response: []string{"Listed by SBL", "Listed by XBL"},
+			},
+			want: want{
+				reason: "Listed by SBL; Listed by XBL",
+			},
+		},
+		{
+			description: "should return error if no TXT record was returned",
+			input: input{
+				response: []string{},
+			},
+			want: want{
+				err: ErrorNoResponse,
+			},
+		},
+		{
+			description: "should return error if lookup failed",
+			input: input{
+				err: net.ErrClosed,
+			},
+			want: want{
+				err: net.ErrClosed,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			var lookup string
+			lookupFunc := func(ctx context.Context, name string) ([]string, error) {
+				lookup = name
+				return test.input.response, test.input.err
+			}
+			got, err := LookupReason(context.Background(), net.ParseIP("1.2.3.4"), DefaultZones[0], lookupFunc)
+
+			// Check error condition
+			assertError(t, err, test.want.err)
+
+			// Check the queried name and reason
+			if lookup != "4.3.2.1.zen.spamhaus.org" {
+				t.Errorf("got lookup %s, want 4.3.2.1.zen.spamhaus.org", lookup)
+			}
+			if got != test.want.reason {
+				t.Errorf("got %s, want %s", got, test.want.reason)
+			}
+		})
+	}
+}
+
+func TestBuildResult(t *testing.T) {
+	type input struct {
+		responseCodes []net.IP
+		err           error
+	}
+	type want struct {
+		status       model.LookupStatus
+		responseCode string
+		errorClass   model.DNSErrorClass
+	}
+
+	tests := []struct {
+		description string
+		input       input
+		want        want
+	}{
+		{
+			description: "should build listed result",
+			input: input{
+				responseCodes: []net.IP{net.ParseIP("127.0.0.4")},
+			},
+			want: want{
+				status:       model.LookupStatusListed,
+				responseCode: "127.0.0.4",
+			},
+		},
+		{
+			description: "should build listed result with every response code",
+			input: input{
+				responseCodes: []net.IP{net.ParseIP("127.0.0.4"), net.ParseIP("127.0.0.10")},
+			},
+			want: want{
+				status:       model.LookupStatusListed,
+				responseCode: "127.0.0.4,127.0.0.10",
+			},
+		},
+		{
+			description: "should build not listed result",
+			input: input{
+				err: ErrorNotListed,
+			},
+			want: want{
+				status: model.LookupStatusNotListed,
+			},
+		},
+		{
+			description: "should build zone error result",
+			input: input{
+				err: &ZoneError{Zone: "spamhaus-zen", ResponseCode: "127.255.255.255", Err: ErrorZoneRateLimited},
+			},
+			want: want{
+				status:       model.LookupStatusZoneError,
+				responseCode: "127.255.255.255",
+				errorClass:   model.DNSErrorClassRateLimited,
+			},
+		},
+		{
+			description: "should build error result with error class",
+			input: input{
+				err: &net.DNSError{Err: "server misbehaving", IsTemporary: true},
+			},
+			want: want{
+				status:     model.LookupStatusError,
+				errorClass: model.DNSErrorClassServfail,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := BuildResult(net.ParseIP("1.2.3.4"), DefaultZones[0], test.input.responseCodes, test.input.err)
+
+			// Check status
+			if got.Status != test.want.status {
+				t.Errorf("got status %s, want %s", got.Status, test.want.status)
+			}
+
+			// Check response code
+			if test.want.responseCode == "" && got.ResponseCode != nil {
+				t.Errorf("got response code %s, want none", *got.ResponseCode)
+			}
+			if test.want.responseCode != "" && (got.ResponseCode == nil || *got.ResponseCode != test.want.responseCode) {
+				t.Errorf("got response code %v, want %s", got.ResponseCode, test.want.responseCode)
+			}
+
+			// Check error class
+			if test.want.errorClass == "" && got.ErrorClass != nil {
+				t.Errorf("got error class %s, want none", *got.ErrorClass)
+			}
+			if test.want.errorClass != "" && (got.ErrorClass == nil || *got.ErrorClass != test.want.errorClass) {
+				t.Errorf("got error class %v, want %s", got.ErrorClass, test.want.errorClass)
+			}
+		})
+	}
+}
+
+func TestProcessIP(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer database.Close()
+
+	t.Run("should store timed out query as error result", func(t *testing.T) {
+		// Simulate a resolver that hangs until the query is cancelled
+		config := LookupConfig{
+			LookupFunc: func(ctx context.Context, host string) ([]string, error) {
+				<-ctx.Done()
+				return nil, ctx.Err()
+			},
+			QueryTimeout: time.Millisecond,
+		}
+
+		expectStoreResult(mock, "1.2.3.4", "spamhaus-zen", "ERROR", nil, "TIMEOUT", nil)
+
+		ProcessIP(context.Background(), db.NewSQLiteStore(database), config, DefaultZones, "job", net.ParseIP("1.2.3.4"))
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should stop without storing results once the context is done", func(t *testing.T) {
+		// The job times out while the first zone is queried
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		config := LookupConfig{
+			LookupFunc: func(ctx context.Context, host string) ([]string, error) {
+				cancel()
+				return nil, ctx.Err()
+			},
+		}
+		zones := []Zone{
+			{Name: "spamhaus-zen", Suffix: "zen.spamhaus.org", Enabled: true},
+			{Name: "spamcop", Suffix: "bl.spamcop.net", Enabled: true},
+		}
+
+		// No query is expected, so storing a result would have failed with another error
+		err := ProcessIP(ctx, db.NewSQLiteStore(database), config, zones, "job", net.ParseIP("1.2.3.4"))
+		if err != context.Canceled {
+			t.Errorf("got error '%v', wanted '%s'", err, context.Canceled)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should store listing reason", func(t *testing.T) {
+		config := LookupConfig{
+			LookupFunc: func(ctx context.Context, host string) ([]string, error) {
+				return []string{"127.0.0.4"}, nil
+			},
+			TXTLookupFunc: func(ctx context.Context, name string) ([]string, error) {
+				return []string{"Listed by XBL"}, nil
+			},
+		}
+
+		expectStoreResult(mock, "1.2.3.4", "spamhaus-zen", "LISTED", "127.0.0.4", nil, "Listed by XBL")
+
+		ProcessIP(context.Background(), db.NewSQLiteStore(database), config, DefaultZones, "job", net.ParseIP("1.2.3.4"))
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should publish stored results", func(t *testing.T) {
+		config := LookupConfig{
+			LookupFunc: func(ctx context.Context, host string) ([]string, error) {
+				return nil, &net.DNSError{Err: "no such host", IsNotFound: true}
+			},
+			Broker: NewResultBroker(),
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		results := config.Broker.Subscribe(ctx, "job", nil)
+
+		expectStoreResult(mock, "1.2.3.4", "spamhaus-zen", "NOT_LISTED", nil, nil, nil)
+
+		err := ProcessIP(context.Background(), db.NewSQLiteStore(database), config, DefaultZones, "job", net.ParseIP("1.2.3.4"))
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		select {
+		case result := <-results:
+			if result.IPAddress.String() != "1.2.3.4" || result.Status != model.LookupStatusNotListed {
+				t.Errorf("got %v, want NOT_LISTED result of 1.2.3.4", result)
+			}
+		default:
+			t.Error("no result was published")
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
+
+// expectStoreResult expects a lookup result of a previously unchecked IP to be upserted and
+// recorded in the lookup history
+func expectStoreResult(mock sqlmock.Sqlmock, ip string, zone string, status string, responseCode interface{}, errorClass interface{}, reason interface{}) {
+	mock.ExpectBegin()
+	mock.ExpectPrepare(`INSERT INTO address_results(.+)`)
+	mock.
+		ExpectExec(`INSERT INTO address_results(.+)`).
+		WithArgs(sqlmock.AnyArg(), ip, zone, status, responseCode, errorClass, reason, sqlmock.AnyArg(), sqlmock.AnyArg(), []byte(net.ParseIP(ip).To16())).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// The IP has no history, so a listing is new
+	mock.
+		ExpectQuery(`SELECT status, response_code FROM lookup_history(.+)`).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "response_code"}))
+	if status == "LISTED" {
+		mock.
+			ExpectExec(`INSERT INTO listing_events(.+)`).
+			WithArgs(ip, zone, "LISTED", nil, responseCode, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+	}
+
+	mock.
+		ExpectExec(`INSERT INTO lookup_history(.+)`).
+		WithArgs(ip, zone, status, responseCode, errorClass, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
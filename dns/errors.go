@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+// Error definitions
+var ErrorZoneMalformedQuery = errors.New("zone rejected the query as malformed")
+var ErrorZonePublicResolver = errors.New("zone refused the query because it came from a public resolver")
+var ErrorZoneRateLimited = errors.New("zone refused the query because the query limit was exceeded")
+var ErrorZoneRefused = errors.New("zone refused the query")
+
+// serverMisbehaving is the error the resolver reports when the DNS server answers with SERVFAIL
+const serverMisbehaving = "server misbehaving"
+
+// zoneErrorNetwork contains the response codes zones reserve for reporting errors
+var zoneErrorNetwork = &net.IPNet{IP: net.IPv4(127, 255, 255, 0), Mask: net.CIDRMask(24, 32)}
+
+// zoneErrorCodes maps the error codes zones answer with to the reason the query was refused
+var zoneErrorCodes = map[string]error{
+	"127.255.255.252": ErrorZoneMalformedQuery,
+	"127.255.255.254": ErrorZonePublicResolver,
+	"127.255.255.255": ErrorZoneRateLimited,
+}
+
+// ZoneError is returned when a zone answers a query with one of its error codes instead of a listing
+type ZoneError struct {
+	// Zone is the name of the zone that refused the query
+	Zone string
+	// ResponseCode is the error code the zone answered with
+	ResponseCode string
+	// Err is the reason the query was refused
+	Err error
+}
+
+// Error describes the zone error
+func (e *ZoneError) Error() string {
+	return fmt.Sprintf("zone %s answered with error code %s: %s", e.Zone, e.ResponseCode, e.Err)
+}
+
+// Unwrap returns the reason the query was refused
+func (e *ZoneError) Unwrap() error {
+	return e.Err
+}
+
+// checkZoneError returns a ZoneError if the response code is one of the zone error codes
+func checkZoneError(zone Zone, responseCode string) error {
+	ip := net.ParseIP(responseCode)
+	if ip == nil || !zoneErrorNetwork.Contains(ip) {
+		return nil
+	}
+
+	// Unknown codes in the error range are still errors
+	reason, ok := zoneErrorCodes[responseCode]
+	if !ok {
+		reason = ErrorZoneRefused
+	}
+
+	return &ZoneError{Zone: zone.Name, ResponseCode: responseCode, Err: reason}
+}
+
+// ClassifyError determines the class of DNS error that caused a lookup to fail
+func ClassifyError(err error) model.DNSErrorClass {
+	switch {
+	case errors.Is(err, ErrorNotListed):
+		return model.DNSErrorClassNxdomain
+	case errors.Is(err, ErrorNoResponse):
+		return model.DNSErrorClassNoResponse
+	case errors.Is(err, ErrorUnexpectedResponse):
+		return model.DNSErrorClassUnexpectedResponse
+	case errors.Is(err, context.DeadlineExceeded):
+		return model.DNSErrorClassTimeout
+	case errors.Is(err, ErrorZoneMalformedQuery):
+		return model.DNSErrorClassMalformedQuery
+	case errors.Is(err, ErrorZonePublicResolver):
+		return model.DNSErrorClassPublicResolver
+	case errors.Is(err, ErrorZoneRateLimited):
+		return model.DNSErrorClassRateLimited
+	case errors.Is(err, ErrorZoneRefused):
+		return model.DNSErrorClassZoneRefused
+	}
+
+	// Inspect errors returned by the resolver
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) {
+		switch {
+		case dnsError.IsNotFound:
+			return model.DNSErrorClassNxdomain
+		case dnsError.IsTimeout:
+			return model.DNSErrorClassTimeout
+		case dnsError.Err == serverMisbehaving:
+			return model.DNSErrorClassServfail
+		}
+	}
+
+	return model.DNSErrorClassUnknown
+}
@@ -0,0 +1,126 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestClassifyError(t *testing.T) {
+	type input struct {
+		err error
+	}
+	type want struct {
+		errorClass model.DNSErrorClass
+	}
+
+	tests := []struct {
+		description string
+		input       input
+		want        want
+	}{
+		{
+			description: "should classify NXDOMAIN",
+			input: input{
+				err: &net.DNSError{Err: "no such host", IsNotFound: true},
+			},
+			want: want{
+				errorClass: model.DNSErrorClassNxdomain,
+			},
+		},
+		{
+			description: "should classify SERVFAIL",
+			input: input{
+				err: &net.DNSError{Err: "server misbehaving", IsTemporary: true},
+			},
+			want: want{
+				errorClass: model.DNSErrorClassServfail,
+			},
+		},
+		{
+			description: "should classify resolver timeout",
+			input: input{
+				err: &net.DNSError{Err: "i/o timeout", IsTimeout: true},
+			},
+			want: want{
+				errorClass: model.DNSErrorClassTimeout,
+			},
+		},
+		{
+			description: "should classify exceeded deadline",
+			input: input{
+				err: fmt.Errorf("lookup failed: %w", context.DeadlineExceeded),
+			},
+			want: want{
+				errorClass: model.DNSErrorClassTimeout,
+			},
+		},
+		{
+			description: "should classify missing response",
+			input: input{
+				err: ErrorNoResponse,
+			},
+			want: want{
+				errorClass: model.DNSErrorClassNoResponse,
+			},
+		},
+		{
+			description: "should classify unexpected response",
+			input: input{
+				err: ErrorUnexpectedResponse,
+			},
+			want: want{
+				errorClass: model.DNSErrorClassUnexpectedResponse,
+			},
+		},
+		{
+			description: "should classify malformed query zone error",
+			input: input{
+				err: &ZoneError{Zone: "spamhaus-zen", ResponseCode: "127.255.255.252", Err: ErrorZoneMalformedQuery},
+			},
+			want: want{
+				errorClass: model.DNSErrorClassMalformedQuery,
+			},
+		},
+		{
+			description: "should classify public resolver zone error",
+			input: input{
+				err: &ZoneError{Zone: "spamhaus-zen", ResponseCode: "127.255.255.254", Err: ErrorZonePublicResolver},
+			},
+			want: want{
+				errorClass: model.DNSErrorClassPublicResolver,
+			},
+		},
+		{
+			description: "should classify rate limited zone error",
+			input: input{
+				err: &ZoneError{Zone: "spamhaus-zen", ResponseCode: "127.255.255.255", Err: ErrorZoneRateLimited},
+			},
+			want: want{
+				errorClass: model.DNSErrorClassRateLimited,
+			},
+		},
+		{
+			description: "should classify unknown errors",
+			input: input{
+				err: errors.New("unknown"),
+			},
+			want: want{
+				errorClass: model.DNSErrorClassUnknown,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := ClassifyError(test.input.err)
+			if got != test.want.errorClass {
+				t.Errorf("got %s, want %s", got, test.want.errorClass)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+// DefaultHealthWindow is how long a zone is considered unhealthy after refusing a query
+const DefaultHealthWindow = time.Hour
+
+// zoneState holds the last zone error of a zone
+type zoneState struct {
+	err *ZoneError
+	at  time.Time
+}
+
+// HealthTracker tracks zones that recently refused queries. While a zone is refusing queries,
+// its clean results cannot be trusted.
+type HealthTracker struct {
+	window time.Duration
+	now    func() time.Time
+
+	mutex sync.RWMutex
+	zones map[string]zoneState
+}
+
+// NewHealthTracker creates a tracker that considers zones unhealthy for the given window
+// after they refuse a query
+func NewHealthTracker(window time.Duration) *HealthTracker {
+	return &HealthTracker{
+		window: window,
+		now:    time.Now,
+		zones:  map[string]zoneState{},
+	}
+}
+
+// Record records the outcome of a query against the zone
+func (h *HealthTracker) Record(zone string, err error) {
+	var zoneError *ZoneError
+	if !errors.As(err, &zoneError) {
+		return
+	}
+
+	log.Printf("WARNING: zone %s is refusing queries, clean results may be unreliable: %s", zone, zoneError)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.zones[zone] = zoneState{err: zoneError, at: h.now()}
+}
+
+// lastError returns the zone's last zone error if it occurred within the health window
+func (h *HealthTracker) lastError(zone string) (zoneState, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	state, ok := h.zones[zone]
+	if !ok || h.now().Sub(state.at) > h.window {
+		return zoneState{}, false
+	}
+	return state, true
+}
+
+// Warning returns a warning if the zone recently refused queries
+func (h *HealthTracker) Warning(zone string) *string {
+	state, ok := h.lastError(zone)
+	if !ok {
+		return nil
+	}
+
+	warning := fmt.Sprintf("zone %s refused a query at %s (%s), clean results may be unreliable",
+		zone, state.at.Format(time.RFC3339), state.err.Err)
+	return &warning
+}
+
+// Status reports the health of each of the given zones
+func (h *HealthTracker) Status(zones []Zone) []*model.ZoneHealth {
+	statuses := []*model.ZoneHealth{}
+
+	for _, zone := range zones {
+		status := &model.ZoneHealth{
+			Zone:    zone.Name,
+			Healthy: true,
+		}
+
+		state, ok := h.lastError(zone.Name)
+		if ok {
+			errorClass := ClassifyError(state.err)
+			lastErrorAt := state.at.UTC()
+
+			status.Healthy = false
+			status.Warning = h.Warning(zone.Name)
+			status.LastErrorClass = &errorClass
+			status.LastErrorAt = &lastErrorAt
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
@@ -0,0 +1,50 @@
+package dns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthTracker(t *testing.T) {
+	zoneError := &ZoneError{Zone: "spamhaus-zen", ResponseCode: "127.255.255.254", Err: ErrorZonePublicResolver}
+
+	t.Run("should report zone as healthy without zone errors", func(t *testing.T) {
+		tracker := NewHealthTracker(time.Hour)
+		tracker.Record("spamhaus-zen", ErrorNotListed)
+
+		if tracker.Warning("spamhaus-zen") != nil {
+			t.Error("got warning for healthy zone")
+		}
+
+		status := tracker.Status(DefaultZones)
+		if len(status) != 1 || !status[0].Healthy {
+			t.Errorf("got %v, want healthy zone", status)
+		}
+	})
+
+	t.Run("should report zone as unhealthy after zone error", func(t *testing.T) {
+		tracker := NewHealthTracker(time.Hour)
+		tracker.Record("spamhaus-zen", zoneError)
+
+		if tracker.Warning("spamhaus-zen") == nil {
+			t.Error("didn't get warning for unhealthy zone")
+		}
+
+		status := tracker.Status(DefaultZones)
+		if len(status) != 1 || status[0].Healthy || status[0].LastErrorAt == nil {
+			t.Errorf("got %v, want unhealthy zone", status)
+		}
+	})
+
+	t.Run("should report zone as healthy once the window has passed", func(t *testing.T) {
+		tracker := NewHealthTracker(time.Hour)
+		tracker.Record("spamhaus-zen", zoneError)
+
+		// Move the tracker's clock past the health window
+		tracker.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+		if tracker.Warning("spamhaus-zen") != nil {
+			t.Error("got warning after health window passed")
+		}
+	})
+}
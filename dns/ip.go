@@ -1,17 +1,22 @@
 package dns
 
 import (
-	"errors"
 	"net"
+	"strconv"
 	"strings"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
 )
 
-// Error definitions
-var ErrorInvalidIP = errors.New("provided IP is not a valid IP")
-var ErrorNonIPV4Address = errors.New("provided IP is not an IPv4 address")
+// ReverseIP reverses the given IP into the format used to query DNS blocklists. IPv4
+// addresses have their octets reversed, while IPv6 addresses are reversed nibble by
+// nibble as described in RFC 5782.
+func ReverseIP(ip net.IP) string {
+	// IPv6 addresses are expanded into their reversed nibbles
+	if ip.To4() == nil {
+		return reverseIPv6(ip)
+	}
 
-// ReverseIP reverses the given IP
-func ReverseIP(ip net.IP) net.IP {
 	// Split address by address delimeter
 	splitAddress := strings.Split(ip.String(), ".")
 
@@ -21,31 +26,132 @@ func ReverseIP(ip net.IP) net.IP {
 	}
 
 	// Join the reversed address parts
-	reversedAddress := strings.Join(splitAddress, ".")
+	return strings.Join(splitAddress, ".")
+}
+
+// reverseIPv6 reverses the nibbles of the given IPv6 address
+func reverseIPv6(ip net.IP) string {
+	address := ip.To16()
+	nibbles := make([]string, 0, len(address)*2)
 
-	return net.ParseIP(reversedAddress)
+	// Walk the address backwards, emitting the low nibble of each byte before the high nibble
+	for i := len(address) - 1; i >= 0; i-- {
+		nibbles = append(nibbles,
+			strconv.FormatUint(uint64(address[i]&0x0f), 16),
+			strconv.FormatUint(uint64(address[i]>>4), 16),
+		)
+	}
+
+	return strings.Join(nibbles, ".")
 }
 
-// ValidateIPs validates and normalizes a list of IPs
-func ValidateIPs(ips []string) ([]net.IP, error) {
+// MaxRangeBitsLimit is the largest allowed range size, in host bits, since every address of an
+// enqueued range is held in memory and stored as a job item
+const MaxRangeBitsLimit = 16
+
+// ValidateIPs validates and normalizes a list of IPv4 and IPv6 addresses and CIDR ranges,
+// reporting the outcome of each entry in order. Ranges are expanded into their addresses as
+// long as they have at most maxRangeBits host bits. Entries that are not valid, only repeat
+// earlier entries, that no enabled zone of the registry is able to look up or that would bring
+// the total past maxAddresses are rejected, and the remaining IPs are returned to be looked up.
+func ValidateIPs(inputs []string, zones *Registry, maxRangeBits int, maxAddresses int) ([]*model.EnqueueResult, []net.IP) {
+	results := []*model.EnqueueResult{}
 	validIPs := []net.IP{}
+	seen := map[string]bool{}
+
+	for _, input := range inputs {
+		result := &model.EnqueueResult{Input: input}
+		results = append(results, result)
+
+		// Parse and validate the entry, ignoring surrounding whitespace left by scraped input
+		entry := strings.TrimSpace(input)
+		ips := []net.IP{}
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				result.Status = model.EnqueueStatusInvalid
+				continue
+			}
+
+			ones, bits := network.Mask.Size()
+			if bits-ones > maxRangeBits || bits-ones > MaxRangeBitsLimit {
+				result.Status = model.EnqueueStatusTooLarge
+				continue
+			}
+			ips = expandNetwork(network)
+		} else {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				result.Status = model.EnqueueStatusInvalid
+				continue
+			}
+			result.IPAddress = ip
+			ips = append(ips, ip)
+		}
+
+		// Make sure at least one enabled zone is able to list the IPs, which all share a family
+		if !zones.Supports(ips[0]) {
+			result.Status = model.EnqueueStatusUnsupported
+			continue
+		}
 
-	// Validate and convert to native IP type
-	for _, ipString := range ips {
-		// Parse and validate the IP. If IP is not valid, return an error
-		ip := net.ParseIP(ipString)
-		if ip == nil {
-			return nil, ErrorInvalidIP
+		// The same IP may be written in several ways or be part of several ranges, so compare
+		// canonical forms
+		newIPs := []net.IP{}
+		for _, ip := range ips {
+			if !seen[ip.String()] {
+				newIPs = append(newIPs, ip)
+			}
+		}
+		if len(newIPs) == 0 {
+			result.Status = model.EnqueueStatusDuplicate
+			continue
+		}
+
+		// Entries are accepted whole, so an entry that does not fit leaves room for smaller ones
+		if len(validIPs)+len(newIPs) > maxAddresses {
+			result.Status = model.EnqueueStatusLimitExceeded
+			continue
 		}
 
-		// If ip is not an IPv4 address, return an error
-		if ip.To4() == nil {
-			return nil, ErrorNonIPV4Address
+		for _, ip := range newIPs {
+			seen[ip.String()] = true
+			validIPs = append(validIPs, ip)
 		}
+		result.Count = len(newIPs)
+		result.Status = model.EnqueueStatusAccepted
+	}
+
+	return results, validIPs
+}
+
+// expandNetwork lists every address of the given network in order
+func expandNetwork(network *net.IPNet) []net.IP {
+	ones, bits := network.Mask.Size()
+	size := 1 << uint(bits-ones)
 
-		// If IP is valid, add it to list of IPs to lookup
-		validIPs = append(validIPs, ip)
+	ips := make([]net.IP, 0, size)
+	ip := network.IP
+	for i := 0; i < size; i++ {
+		ips = append(ips, ip)
+		ip = nextIP(ip)
+	}
+
+	return ips
+}
+
+// nextIP returns the address following the given one
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+
+	// Increment the last byte, carrying over into the preceding bytes
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
 	}
 
-	return validIPs, nil
+	return next
 }
@@ -2,7 +2,10 @@ package dns
 
 import (
 	"net"
+	"reflect"
 	"testing"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
 )
 
 // asserError compares 2 errors
@@ -52,14 +55,41 @@ func TestReverseIP(t *testing.T) {
 				ipAddress: "1.0.0.127",
 			},
 		},
+		{
+			description: "should reverse IPv6 address by nibble",
+			input: input{
+				ipAddress: "2001:db8:1:2:3:4:567:89ab",
+			},
+			want: want{
+				ipAddress: "b.a.9.8.7.6.5.0.4.0.0.0.3.0.0.0.2.0.0.0.1.0.0.0.8.b.d.0.1.0.0.2",
+			},
+		},
+		{
+			description: "should expand compressed IPv6 address",
+			input: input{
+				ipAddress: "2001:db8::1",
+			},
+			want: want{
+				ipAddress: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2",
+			},
+		},
+		{
+			description: "should reverse IPv4-mapped IPv6 address as IPv4",
+			input: input{
+				ipAddress: "::ffff:1.2.3.4",
+			},
+			want: want{
+				ipAddress: "4.3.2.1",
+			},
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
 			got := ReverseIP(net.ParseIP(test.input.ipAddress))
 
-			// Check response codes
-			if test.want.ipAddress != "" && got != nil && test.want.ipAddress != got.String() {
+			// Check reversed address
+			if test.want.ipAddress != got {
 				t.Errorf("got %s, want %s", got, test.want.ipAddress)
 			}
 		})
@@ -67,64 +97,122 @@ func TestReverseIP(t *testing.T) {
 }
 
 func TestValidateIPs(t *testing.T) {
-	type input struct {
-		ipAddresses []string
-	}
-	type want struct {
-		err error
-	}
+	registry, err := NewRegistry([]Zone{
+		{Name: "spamcop", Suffix: "bl.spamcop.net", Enabled: true},
+	})
+	assertError(t, err, nil)
+
+	// Ranges of up to 4 addresses are accepted, and up to 8 addresses per call
+	maxRangeBits := 2
+	maxAddresses := 8
 
 	tests := []struct {
 		description string
-		input       input
-		want        want
+		input       []string
+		want        []model.EnqueueStatus
+		wantCounts  []int
+		wantIPs     []string
+		// maxRangeBits overrides the default range limit, if set
+		maxRangeBits int
 	}{
 		{
-			description: "should return error for invalid IP",
-			input: input{
-				ipAddresses: []string{"not an IP"},
-			},
-			want: want{
-				err: ErrorInvalidIP,
-			},
+			description: "should reject invalid IPs",
+			input:       []string{"not an IP", "127123.0123123.0.1", "10.0.0.0/33"},
+			want:        []model.EnqueueStatus{model.EnqueueStatusInvalid, model.EnqueueStatusInvalid, model.EnqueueStatusInvalid},
+			wantCounts:  []int{0, 0, 0},
+			wantIPs:     []string{},
 		},
 		{
-			description: "should return error for invalid IP",
-			input: input{
-				ipAddresses: []string{"127123.0123123.0.1"},
-			},
-			want: want{
-				err: ErrorInvalidIP,
-			},
+			description: "should accept valid IPs",
+			input:       []string{"1.2.3.4", " 127.0.0.1\n"},
+			want:        []model.EnqueueStatus{model.EnqueueStatusAccepted, model.EnqueueStatusAccepted},
+			wantCounts:  []int{1, 1},
+			wantIPs:     []string{"1.2.3.4", "127.0.0.1"},
 		},
 		{
-			description: "should return list of valid IPs",
-			input: input{
-				ipAddresses: []string{"1.2.3.4", "127.0.0.1"},
-			},
-			want: want{},
+			description: "should reject repeated IPs written in different forms",
+			input:       []string{"1.2.3.4", "::ffff:1.2.3.4", "1.2.3.4"},
+			want:        []model.EnqueueStatus{model.EnqueueStatusAccepted, model.EnqueueStatusDuplicate, model.EnqueueStatusDuplicate},
+			wantCounts:  []int{1, 0, 0},
+			wantIPs:     []string{"1.2.3.4"},
 		},
 		{
-			description: "should return error for IPv6 address",
-			input: input{
-				ipAddresses: []string{"2001:0db8:85a3:0000:0000:8a2e:0370:7334"},
-			},
-			want: want{
-				err: ErrorNonIPV4Address,
+			description: "should reject IPs of families no enabled zone supports",
+			input:       []string{"2001:0db8:85a3:0000:0000:8a2e:0370:7334", "2001:db8::/127", "1.2.3.4"},
+			want:        []model.EnqueueStatus{model.EnqueueStatusUnsupported, model.EnqueueStatusUnsupported, model.EnqueueStatusAccepted},
+			wantCounts:  []int{0, 0, 1},
+			wantIPs:     []string{"1.2.3.4"},
+		},
+		{
+			description: "should expand CIDR ranges",
+			input:       []string{"203.0.113.5/30", "10.0.0.1/32"},
+			want:        []model.EnqueueStatus{model.EnqueueStatusAccepted, model.EnqueueStatusAccepted},
+			wantCounts:  []int{4, 1},
+			wantIPs:     []string{"203.0.113.4", "203.0.113.5", "203.0.113.6", "203.0.113.7", "10.0.0.1"},
+		},
+		{
+			description: "should skip addresses of ranges that were already given",
+			input:       []string{"203.0.113.1", "203.0.113.0/30", "203.0.113.2/31"},
+			want:        []model.EnqueueStatus{model.EnqueueStatusAccepted, model.EnqueueStatusAccepted, model.EnqueueStatusDuplicate},
+			wantCounts:  []int{1, 3, 0},
+			wantIPs:     []string{"203.0.113.1", "203.0.113.0", "203.0.113.2", "203.0.113.3"},
+		},
+		{
+			description: "should reject ranges larger than the limit",
+			input:       []string{"203.0.113.0/29", "10.0.0.0/8"},
+			want:        []model.EnqueueStatus{model.EnqueueStatusTooLarge, model.EnqueueStatusTooLarge},
+			wantCounts:  []int{0, 0},
+			wantIPs:     []string{},
+		},
+		{
+			description:  "should reject ranges past the hard limit regardless of the configured one",
+			input:        []string{"10.0.0.0/8", "2001:db8::/64"},
+			want:         []model.EnqueueStatus{model.EnqueueStatusTooLarge, model.EnqueueStatusTooLarge},
+			wantCounts:   []int{0, 0},
+			wantIPs:      []string{},
+			maxRangeBits: 64,
+		},
+		{
+			description: "should reject entries that do not fit in the address limit",
+			input:       []string{"203.0.113.0/30", "198.51.100.0/31", "192.0.2.0/30", "10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			want: []model.EnqueueStatus{
+				model.EnqueueStatusAccepted,
+				model.EnqueueStatusAccepted,
+				model.EnqueueStatusLimitExceeded,
+				model.EnqueueStatusAccepted,
+				model.EnqueueStatusAccepted,
+				model.EnqueueStatusLimitExceeded,
 			},
+			wantCounts: []int{4, 2, 0, 1, 1, 0},
+			wantIPs:    []string{"203.0.113.0", "203.0.113.1", "203.0.113.2", "203.0.113.3", "198.51.100.0", "198.51.100.1", "10.0.0.1", "10.0.0.2"},
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.description, func(t *testing.T) {
-			got, err := ValidateIPs(test.input.ipAddresses)
+			limit := maxRangeBits
+			if test.maxRangeBits != 0 {
+				limit = test.maxRangeBits
+			}
+			results, ips := ValidateIPs(test.input, registry, limit, maxAddresses)
 
-			// Check error
-			assertError(t, err, test.want.err)
+			// Check the outcome of each input
+			if len(results) != len(test.want) {
+				t.Fatalf("got %d results, wanted %d", len(results), len(test.want))
+			}
+			for i, result := range results {
+				if result.Input != test.input[i] || result.Status != test.want[i] || result.Count != test.wantCounts[i] {
+					t.Errorf("got %s (%d IPs) for %q, want %s (%d IPs) for %q", result.Status, result.Count, result.Input, test.want[i], test.wantCounts[i], test.input[i])
+				}
+			}
 
-			// Check result
-			if err == nil && len(got) != len(test.input.ipAddresses) {
-				t.Errorf("got list of length %d, wanted %d", len(got), len(test.input.ipAddresses))
+			// Check IPs to look up
+			got := []string{}
+			for _, ip := range ips {
+				got = append(got, ip.String())
+			}
+			if !reflect.DeepEqual(got, test.wantIPs) {
+				t.Errorf("got IPs %v, want %v", got, test.wantIPs)
 			}
 		})
 	}
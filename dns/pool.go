@@ -0,0 +1,271 @@
+package dns
+
+import (
+	"context"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/grantsavage/ip-lookup-api/db"
+	uuid "github.com/satori/go.uuid"
+)
+
+// DefaultPollInterval is how often the dispatcher checks the database for pending IPs when
+// it is not woken up by an enqueue
+const DefaultPollInterval = 5 * time.Second
+
+// DefaultLeaseDuration is how long a claimed IP is left to the pool that claimed it without the
+// pool refreshing its claim, before any pool resumes it. Pools refresh their claims three times
+// as often, so that only the IPs of pools which stopped are resumed.
+const DefaultLeaseDuration = time.Minute
+
+// Task is a single IP waiting to be looked up by a worker
+type Task struct {
+	// ItemID is the ID of the job item the IP was enqueued as
+	ItemID int64
+	// JobID is the ID of the job the IP was enqueued with
+	JobID string
+	// IP is the IP to look up
+	IP net.IP
+	// Deadline is when the job the IP was enqueued with times out. Zero means no deadline
+	Deadline time.Time
+}
+
+// Pool is a long-lived pool of workers looking up enqueued IPs. Enqueued IPs are stored in
+// the database first, and a dispatcher feeds them to the workers through a bounded queue,
+// so IPs that have not been looked up yet survive restarts.
+type Pool struct {
+	database     db.Store
+	config       LookupConfig
+	zones        []Zone
+	workers      int
+	pollInterval time.Duration
+
+	// owner identifies the pool's claims on job items among the pools sharing the database
+	owner         string
+	leaseDuration time.Duration
+
+	queue chan Task
+	wake  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewPool creates a pool of workers that look up IPs against the given zones. At most
+// queueSize IPs are handed to the workers at once.
+func NewPool(database db.Store, config LookupConfig, zones []Zone, workers int, queueSize int) *Pool {
+	return &Pool{
+		database:      database,
+		config:        config,
+		zones:         zones,
+		workers:       workers,
+		pollInterval:  DefaultPollInterval,
+		owner:         uuid.NewV4().String(),
+		leaseDuration: DefaultLeaseDuration,
+		queue:         make(chan Task, queueSize),
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+// Start resumes IPs that were being looked up by pools which have since stopped and starts the
+// dispatcher and workers. They stop once the context is cancelled.
+func (p *Pool) Start(ctx context.Context) error {
+	err := p.resume()
+	if err != nil {
+		return err
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.dispatch(ctx)
+	}()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.maintainLeases(ctx)
+	}()
+
+	for i := 0; i < p.workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			BlocklistWorker(ctx, p.database, p.config, p.zones, p.queue)
+		}()
+	}
+
+	return nil
+}
+
+// Wait blocks until the dispatcher and every worker have stopped
+func (p *Pool) Wait() {
+	p.wg.Wait()
+}
+
+// Enqueue stores a list of IPs as a job and wakes up the dispatcher. The job's ID is returned
+// once every IP has been stored.
+func (p *Pool) Enqueue(ips []net.IP) (string, error) {
+	ipStrings := []string{}
+	for _, ip := range ips {
+		ipStrings = append(ipStrings, ip.String())
+	}
+
+	jobID, err := p.database.CreateJob(ipStrings)
+	if err != nil {
+		return "", err
+	}
+
+	// The dispatcher only needs to be woken up once, so never block here
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+
+	return jobID, nil
+}
+
+// dispatch claims pending job items from the database and hands them to the workers
+func (p *Pool) dispatch(ctx context.Context) {
+	ticker := time.NewTicker(p.pollInterval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		// Claim as many items as the queue has room for and hand them to the workers. While
+		// the queue is full, pending items are claimed again once the workers made room
+		claimed, err := p.claim(ctx)
+		if err != nil {
+			log.Printf("error occurred while claiming enqueued IPs: %s\n", err.Error())
+		}
+		if claimed > 0 {
+			continue
+		}
+
+		// Wait for new IPs to be enqueued
+		select {
+		case <-ctx.Done():
+			return
+		case <-p.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// resume returns the IPs whose claim expired to the pending state
+func (p *Pool) resume() error {
+	resumed, err := p.database.ResetJobItems(time.Now().Add(-p.leaseDuration))
+	if err != nil {
+		return err
+	}
+	if resumed > 0 {
+		log.Printf("resuming %d interrupted IP lookup(s)", resumed)
+	}
+	return nil
+}
+
+// maintainLeases refreshes the pool's claims on the IPs it is looking up and resumes the IPs of
+// pools that stopped, since other pools may share the database
+func (p *Pool) maintainLeases(ctx context.Context) {
+	ticker := time.NewTicker(p.leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.renewLeases()
+		}
+	}
+}
+
+// renewLeases refreshes the pool's claims, then resumes the IPs whose claim expired
+func (p *Pool) renewLeases() {
+	_, err := p.database.RenewJobItems(p.owner)
+	if err != nil {
+		log.Printf("error occurred while renewing claimed IPs: %s\n", err.Error())
+	}
+
+	err = p.resume()
+	if err != nil {
+		log.Printf("error occurred while resuming interrupted IPs: %s\n", err.Error())
+	}
+}
+
+// claim claims as many pending job items as the queue has room for and sends them to the
+// queue, returning the number claimed. Items are left for other pools while the queue is full.
+func (p *Pool) claim(ctx context.Context) (int, error) {
+	free := cap(p.queue) - len(p.queue)
+	if free == 0 {
+		return 0, nil
+	}
+
+	items, err := p.database.ClaimJobItems(p.owner, free)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range items {
+		task := Task{ItemID: item.ID, JobID: item.JobID, IP: net.ParseIP(item.IPAddress)}
+
+		// The job timeout counts from when the job was enqueued
+		if p.config.JobTimeout > 0 {
+			task.Deadline = item.CreatedAt.Add(p.config.JobTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			// Claimed items are resumed once their claim expires
+			return len(items), nil
+		case p.queue <- task:
+		}
+	}
+
+	return len(items), nil
+}
+
+// BlocklistWorker takes IPs off the queue, looks each one up against every given zone and
+// additionally stores one lookup result per IP and zone before marking the IP's job item
+// as complete. IPs whose job timed out are marked as failed. The worker stops once the
+// context is cancelled or the queue is closed.
+func BlocklistWorker(ctx context.Context, database db.Store, config LookupConfig, zones []Zone, queue <-chan Task) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case task, ok := <-queue:
+			if !ok {
+				return
+			}
+
+			err := processTask(ctx, database, config, zones, task)
+
+			// Leave the item to be resumed if the application is shutting down
+			if ctx.Err() != nil {
+				return
+			}
+
+			err = database.CompleteJobItem(task.ItemID, err)
+			if err != nil {
+				log.Printf("error occurred while completing lookup of IP %s: %s\n", task.IP, err.Error())
+			}
+		}
+	}
+}
+
+// processTask looks up the task's IP, bounded by the deadline of its job
+func processTask(ctx context.Context, database db.Store, config LookupConfig, zones []Zone, task Task) error {
+	if !task.Deadline.IsZero() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, task.Deadline)
+		defer cancel()
+	}
+
+	// Skip the IP if its job timed out while it was waiting in the queue
+	if ctx.Err() != nil {
+		log.Printf("skipped lookup of IP %s: %s", task.IP, ctx.Err())
+		return ctx.Err()
+	}
+
+	return ProcessIP(ctx, database, config, zones, task.JobID, task.IP)
+}
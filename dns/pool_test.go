@@ -0,0 +1,241 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/grantsavage/ip-lookup-api/db"
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestBlocklistWorker(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer database.Close()
+
+	config := LookupConfig{
+		LookupFunc: func(ctx context.Context, host string) ([]string, error) {
+			return nil, &net.DNSError{Err: "no such host", IsNotFound: true}
+		},
+	}
+
+	t.Run("should process queued IPs until the queue is closed", func(t *testing.T) {
+		queue := make(chan Task, 2)
+		queue <- Task{ItemID: 1, IP: net.ParseIP("1.2.3.4")}
+		queue <- Task{ItemID: 2, IP: net.ParseIP("5.6.7.8")}
+		close(queue)
+
+		for i, ip := range []string{"1.2.3.4", "5.6.7.8"} {
+			expectStoreResult(mock, ip, "spamhaus-zen", "NOT_LISTED", nil, nil, nil)
+			mock.
+				ExpectExec(`UPDATE job_items SET state(.+)`).
+				WithArgs(model.JobItemStateDone, nil, sqlmock.AnyArg(), int64(i+1)).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+		}
+
+		BlocklistWorker(context.Background(), db.NewSQLiteStore(database), config, DefaultZones, queue)
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should fail IPs whose job timed out", func(t *testing.T) {
+		queue := make(chan Task, 1)
+		queue <- Task{ItemID: 1, IP: net.ParseIP("1.2.3.4"), Deadline: time.Now().Add(-time.Second)}
+		close(queue)
+
+		mock.
+			ExpectExec(`UPDATE job_items SET state(.+)`).
+			WithArgs(model.JobItemStateFailed, context.DeadlineExceeded.Error(), sqlmock.AnyArg(), int64(1)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		BlocklistWorker(context.Background(), db.NewSQLiteStore(database), config, DefaultZones, queue)
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should stop once the context is cancelled", func(t *testing.T) {
+		queue := make(chan Task)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		// Returns even though the queue is still open
+		BlocklistWorker(ctx, db.NewSQLiteStore(database), config, DefaultZones, queue)
+	})
+}
+
+func TestPool(t *testing.T) {
+	t.Run("should store enqueued IPs as a job", func(t *testing.T) {
+		database, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer database.Close()
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO jobs(.+)`).WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectPrepare(`INSERT INTO job_items(.+)`)
+		mock.
+			ExpectExec(`INSERT INTO job_items(.+)`).
+			WithArgs(sqlmock.AnyArg(), "1.2.3.4", model.JobItemStatePending, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		pool := NewPool(db.NewSQLiteStore(database), LookupConfig{}, DefaultZones, 1, 1)
+		jobID, err := pool.Enqueue([]net.IP{net.ParseIP("1.2.3.4")})
+		assertError(t, err, nil)
+
+		if jobID == "" {
+			t.Error("got empty job ID")
+		}
+
+		// The dispatcher should have been woken up
+		if len(pool.wake) != 1 {
+			t.Error("dispatcher was not woken up")
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should hand claimed items to the workers with the job deadline", func(t *testing.T) {
+		database, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer database.Close()
+
+		createdAt := time.Now().UTC().Add(-time.Minute)
+		rows := sqlmock.
+			NewRows([]string{"id", "job_id", "ip_address", "state", "error", "created_at", "updated_at"}).
+			AddRow(7, "job", "1.2.3.4", model.JobItemStatePending, nil, createdAt, createdAt)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT(.+)FROM job_items(.+)`).WillReturnRows(rows)
+		mock.ExpectExec(`UPDATE job_items SET state(.+)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		pool := NewPool(db.NewSQLiteStore(database), LookupConfig{JobTimeout: time.Hour}, DefaultZones, 1, 1)
+		claimed, err := pool.claim(context.Background())
+		assertError(t, err, nil)
+
+		if claimed != 1 {
+			t.Fatalf("got %d claimed items, want 1", claimed)
+		}
+
+		task := <-pool.queue
+		if task.ItemID != 7 || task.IP.String() != "1.2.3.4" {
+			t.Errorf("got task %v, want item 7 for 1.2.3.4", task)
+		}
+		if !task.Deadline.After(time.Now().Add(50 * time.Minute)) {
+			t.Errorf("got deadline %s, want an hour after the job was enqueued", task.Deadline)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should only claim as many items as the queue has room for", func(t *testing.T) {
+		database, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer database.Close()
+
+		pool := NewPool(db.NewSQLiteStore(database), LookupConfig{}, DefaultZones, 1, 2)
+		pool.queue <- Task{ItemID: 1, IP: net.ParseIP("1.2.3.4")}
+
+		mock.ExpectBegin()
+		mock.
+			ExpectQuery(`SELECT(.+)FROM job_items(.+)`).
+			WithArgs(model.JobItemStatePending, 1).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "job_id", "ip_address", "state", "error", "created_at", "updated_at"}))
+		mock.ExpectCommit()
+
+		_, err = pool.claim(context.Background())
+		assertError(t, err, nil)
+
+		// Nothing is claimed while the queue is full
+		pool.queue <- Task{ItemID: 2, IP: net.ParseIP("5.6.7.8")}
+		claimed, err := pool.claim(context.Background())
+		assertError(t, err, nil)
+
+		if claimed != 0 {
+			t.Errorf("got %d claimed items, want none", claimed)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should resume items with expired claims on start", func(t *testing.T) {
+		database, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer database.Close()
+
+		mock.
+			ExpectExec(`UPDATE job_items SET state(.+)`).
+			WithArgs(model.JobItemStatePending, sqlmock.AnyArg(), model.JobItemStateProcessing, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		// Stop the pool right away so only the reset happens
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		pool := NewPool(db.NewSQLiteStore(database), LookupConfig{}, DefaultZones, 1, 1)
+		pool.pollInterval = time.Hour
+		err = pool.Start(ctx)
+		assertError(t, err, nil)
+		pool.Wait()
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+
+	t.Run("should renew its own claims before resuming expired ones", func(t *testing.T) {
+		database, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+		}
+		defer database.Close()
+
+		pool := NewPool(db.NewSQLiteStore(database), LookupConfig{}, DefaultZones, 1, 1)
+
+		mock.
+			ExpectExec(`UPDATE job_items SET updated_at(.+)`).
+			WithArgs(sqlmock.AnyArg(), model.JobItemStateProcessing, pool.owner).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.
+			ExpectExec(`UPDATE job_items SET state(.+)`).
+			WithArgs(model.JobItemStatePending, sqlmock.AnyArg(), model.JobItemStateProcessing, sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		pool.renewLeases()
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
@@ -0,0 +1,113 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"strings"
+)
+
+// defaultDNSPort is used for resolver addresses that do not specify a port
+const defaultDNSPort = "53"
+
+// ParseResolverAddresses parses a comma separated list of resolver addresses, adding the
+// default DNS port to addresses without one
+func ParseResolverAddresses(value string) []string {
+	addresses := []string{}
+
+	for _, address := range strings.Split(value, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+
+		// Bare IPs (including IPv6 addresses without brackets) get the default port
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			address = net.JoinHostPort(strings.Trim(address, "[]"), defaultDNSPort)
+		}
+
+		addresses = append(addresses, address)
+	}
+
+	return addresses
+}
+
+// NewResolver creates a resolver that sends every query to the given resolver address,
+// regardless of the servers configured in /etc/resolv.conf
+func NewResolver(address string) *net.Resolver {
+	dialer := net.Dialer{}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		},
+	}
+}
+
+// ResolverLookupFunc creates a lookup function that queries the given resolver addresses in
+// order, failing over to the next resolver when one is unable to answer. If no addresses are
+// given, the system resolver is used.
+func ResolverLookupFunc(addresses []string) HostLookupFunc {
+	if len(addresses) == 0 {
+		return net.DefaultResolver.LookupHost
+	}
+
+	lookupFuncs := []HostLookupFunc{}
+	for _, address := range addresses {
+		lookupFuncs = append(lookupFuncs, NewResolver(address).LookupHost)
+	}
+
+	return failoverLookupFunc(addresses, lookupFuncs)
+}
+
+// ResolverTXTLookupFunc creates a TXT lookup function that queries the given resolver addresses
+// in order, failing over the same way as ResolverLookupFunc
+func ResolverTXTLookupFunc(addresses []string) TXTLookupFunc {
+	if len(addresses) == 0 {
+		return net.DefaultResolver.LookupTXT
+	}
+
+	lookupFuncs := []HostLookupFunc{}
+	for _, address := range addresses {
+		lookupFuncs = append(lookupFuncs, NewResolver(address).LookupTXT)
+	}
+
+	return TXTLookupFunc(failoverLookupFunc(addresses, lookupFuncs))
+}
+
+// failoverLookupFunc tries each lookup function in order until one of them answers
+func failoverLookupFunc(addresses []string, lookupFuncs []HostLookupFunc) HostLookupFunc {
+	return func(ctx context.Context, host string) ([]string, error) {
+		var err error
+
+		for i, lookupFunc := range lookupFuncs {
+			var response []string
+			response, err = lookupFunc(ctx, host)
+			if !shouldFailover(ctx, err) {
+				return response, err
+			}
+
+			log.Printf("resolver %s failed to answer query for %s: %s", addresses[i], host, err)
+		}
+
+		return nil, err
+	}
+}
+
+// shouldFailover checks whether a lookup error means the resolver could not answer the query
+func shouldFailover(ctx context.Context, err error) bool {
+	// There is no point in trying another resolver if the query was cancelled
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+
+	// NXDOMAIN is a valid answer from the zone, not a resolver failure
+	var dnsError *net.DNSError
+	if errors.As(err, &dnsError) && dnsError.IsNotFound {
+		return false
+	}
+
+	return true
+}
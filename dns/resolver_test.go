@@ -0,0 +1,178 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseResolverAddresses(t *testing.T) {
+	type input struct {
+		value string
+	}
+	type want struct {
+		addresses []string
+	}
+
+	tests := []struct {
+		description string
+		input       input
+		want        want
+	}{
+		{
+			description: "should add default port to addresses",
+			input: input{
+				value: "10.0.0.53, 10.0.0.54:5353",
+			},
+			want: want{
+				addresses: []string{"10.0.0.53:53", "10.0.0.54:5353"},
+			},
+		},
+		{
+			description: "should add default port to IPv6 addresses",
+			input: input{
+				value: "2001:db8::53,[2001:db8::54]:5353",
+			},
+			want: want{
+				addresses: []string{"[2001:db8::53]:53", "[2001:db8::54]:5353"},
+			},
+		},
+		{
+			description: "should return no addresses for empty value",
+			input: input{
+				value: "",
+			},
+			want: want{
+				addresses: []string{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := ParseResolverAddresses(test.input.value)
+			if !reflect.DeepEqual(got, test.want.addresses) {
+				t.Errorf("got %v, want %v", got, test.want.addresses)
+			}
+		})
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	t.Run("should dial the configured address", func(t *testing.T) {
+		listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+		defer listener.Close()
+
+		resolver := NewResolver(listener.LocalAddr().String())
+		conn, err := resolver.Dial(context.Background(), "udp", "8.8.8.8:53")
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+		defer conn.Close()
+
+		if conn.RemoteAddr().String() != listener.LocalAddr().String() {
+			t.Errorf("got %s, want %s", conn.RemoteAddr(), listener.LocalAddr())
+		}
+	})
+}
+
+func TestFailoverLookupFunc(t *testing.T) {
+	notFound := &net.DNSError{Err: "no such host", IsNotFound: true}
+	servfail := &net.DNSError{Err: "server misbehaving", IsTemporary: true}
+
+	type input struct {
+		responses [][]string
+		errs      []error
+	}
+	type want struct {
+		response []string
+		err      error
+		queried  int
+	}
+
+	tests := []struct {
+		description string
+		input       input
+		want        want
+	}{
+		{
+			description: "should return answer of first resolver",
+			input: input{
+				responses: [][]string{{"127.0.0.2"}, {"127.0.0.3"}},
+				errs:      []error{nil, nil},
+			},
+			want: want{
+				response: []string{"127.0.0.2"},
+				queried:  1,
+			},
+		},
+		{
+			description: "should fail over to next resolver",
+			input: input{
+				responses: [][]string{nil, {"127.0.0.3"}},
+				errs:      []error{servfail, nil},
+			},
+			want: want{
+				response: []string{"127.0.0.3"},
+				queried:  2,
+			},
+		},
+		{
+			description: "should not fail over on NXDOMAIN",
+			input: input{
+				responses: [][]string{nil, {"127.0.0.3"}},
+				errs:      []error{notFound, nil},
+			},
+			want: want{
+				err:     notFound,
+				queried: 1,
+			},
+		},
+		{
+			description: "should return last error if every resolver fails",
+			input: input{
+				responses: [][]string{nil, nil},
+				errs:      []error{servfail, net.ErrClosed},
+			},
+			want: want{
+				err:     net.ErrClosed,
+				queried: 2,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			queried := 0
+			lookupFuncs := []HostLookupFunc{}
+			for i := range test.input.responses {
+				response, err := test.input.responses[i], test.input.errs[i]
+				lookupFuncs = append(lookupFuncs, func(context.Context, string) ([]string, error) {
+					queried++
+					return response, err
+				})
+			}
+
+			lookupFunc := failoverLookupFunc([]string{"10.0.0.53:53", "10.0.0.54:53"}, lookupFuncs)
+			got, err := lookupFunc(context.Background(), "2.0.0.127.zen.spamhaus.org")
+
+			// Check error condition
+			if !errors.Is(err, test.want.err) {
+				t.Errorf("got error %v, want %v", err, test.want.err)
+			}
+
+			// Check response and number of resolvers queried
+			if !reflect.DeepEqual(got, test.want.response) {
+				t.Errorf("got %v, want %v", got, test.want.response)
+			}
+			if queried != test.want.queried {
+				t.Errorf("queried %d resolvers, want %d", queried, test.want.queried)
+			}
+		})
+	}
+}
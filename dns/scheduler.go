@@ -0,0 +1,96 @@
+package dns
+
+import (
+	"context"
+	"log"
+	"net"
+	"time"
+
+	"github.com/grantsavage/ip-lookup-api/db"
+)
+
+// DefaultRecheckBatchSize is the maximum number of stale IPs re-enqueued at once. Any
+// remaining stale IPs are re-enqueued on the following runs.
+const DefaultRecheckBatchSize = 1000
+
+// Scheduler periodically re-enqueues IPs whose stored results are older than their TTL, so
+// stored results are kept up to date without anyone enqueueing the IPs again
+type Scheduler struct {
+	database  db.Store
+	pool      *Pool
+	listedTTL time.Duration
+	cleanTTL  time.Duration
+	interval  time.Duration
+	batchSize int
+	now       func() time.Time
+}
+
+// NewScheduler creates a scheduler that checks for stale results every interval. Listed results
+// are re-checked once they are older than listedTTL, all other results once they are older than
+// cleanTTL. A TTL of zero disables re-checks of those results.
+func NewScheduler(database db.Store, pool *Pool, listedTTL time.Duration, cleanTTL time.Duration, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		database:  database,
+		pool:      pool,
+		listedTTL: listedTTL,
+		cleanTTL:  cleanTTL,
+		interval:  interval,
+		batchSize: DefaultRecheckBatchSize,
+		now:       time.Now,
+	}
+}
+
+// Start runs the scheduler in the background until the context is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_, err := s.Recheck()
+				if err != nil {
+					log.Printf("error occurred while re-enqueueing stale IPs: %s\n", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// Recheck enqueues IPs with stale results as a single job and returns the number of IPs enqueued
+func (s *Scheduler) Recheck() (int, error) {
+	now := s.now()
+
+	// A zero cutoff matches no results, disabling re-checks of that kind
+	var listedBefore, cleanBefore time.Time
+	if s.listedTTL > 0 {
+		listedBefore = now.Add(-s.listedTTL)
+	}
+	if s.cleanTTL > 0 {
+		cleanBefore = now.Add(-s.cleanTTL)
+	}
+
+	staleIPs, err := s.database.GetStaleIPs(listedBefore, cleanBefore, s.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	if len(staleIPs) == 0 {
+		return 0, nil
+	}
+
+	ips := []net.IP{}
+	for _, ip := range staleIPs {
+		ips = append(ips, net.ParseIP(ip))
+	}
+
+	jobID, err := s.pool.Enqueue(ips)
+	if err != nil {
+		return 0, err
+	}
+
+	log.Printf("re-enqueued %d stale IP(s) as job %s", len(ips), jobID)
+	return len(ips), nil
+}
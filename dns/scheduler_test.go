@@ -0,0 +1,107 @@
+package dns
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/grantsavage/ip-lookup-api/db"
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestSchedulerRecheck(t *testing.T) {
+	database, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer database.Close()
+
+	now := time.Date(2021, 3, 8, 12, 0, 0, 0, time.UTC)
+	pool := NewPool(db.NewSQLiteStore(database), LookupConfig{}, DefaultZones, 1, 10)
+
+	tests := []struct {
+		description  string
+		listedTTL    time.Duration
+		cleanTTL     time.Duration
+		listedBefore time.Time
+		cleanBefore  time.Time
+	}{
+		{
+			description:  "should use separate TTLs for listed and clean results",
+			listedTTL:    24 * time.Hour,
+			cleanTTL:     7 * 24 * time.Hour,
+			listedBefore: time.Date(2021, 3, 7, 12, 0, 0, 0, time.UTC),
+			cleanBefore:  time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			description:  "should not re-check results with a TTL of zero",
+			listedTTL:    0,
+			cleanTTL:     time.Hour,
+			listedBefore: time.Time{},
+			cleanBefore:  time.Date(2021, 3, 8, 11, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			scheduler := NewScheduler(db.NewSQLiteStore(database), pool, test.listedTTL, test.cleanTTL, time.Hour)
+			scheduler.now = func() time.Time { return now }
+
+			mock.
+				ExpectQuery(`SELECT ip_address(.+)FROM address_results(.+)`).
+				WithArgs(
+					model.LookupStatusListed,
+					test.listedBefore,
+					test.cleanBefore,
+					model.JobItemStatePending,
+					model.JobItemStateProcessing,
+					DefaultRecheckBatchSize,
+				).
+				WillReturnRows(sqlmock.NewRows([]string{"ip_address"}).AddRow("1.2.3.4"))
+			mock.ExpectBegin()
+			mock.
+				ExpectExec(`INSERT INTO jobs(.+)`).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectPrepare(`INSERT INTO job_items(.+)`)
+			mock.
+				ExpectExec(`INSERT INTO job_items(.+)`).
+				WithArgs(sqlmock.AnyArg(), "1.2.3.4", model.JobItemStatePending, sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			enqueued, err := scheduler.Recheck()
+			if err != nil {
+				t.Fatalf("error: '%s'", err)
+			}
+			if enqueued != 1 {
+				t.Errorf("got %d enqueued IPs, want 1", enqueued)
+			}
+
+			err = mock.ExpectationsWereMet()
+			if err != nil {
+				t.Errorf("expectations were not met: '%s'", err)
+			}
+		})
+	}
+
+	t.Run("should not create a job without stale IPs", func(t *testing.T) {
+		scheduler := NewScheduler(db.NewSQLiteStore(database), pool, time.Hour, time.Hour, time.Hour)
+
+		mock.
+			ExpectQuery(`SELECT ip_address(.+)FROM address_results(.+)`).
+			WillReturnRows(sqlmock.NewRows([]string{"ip_address"}))
+
+		enqueued, err := scheduler.Recheck()
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+		if enqueued != 0 {
+			t.Errorf("got %d enqueued IPs, want 0", enqueued)
+		}
+
+		err = mock.ExpectationsWereMet()
+		if err != nil {
+			t.Errorf("expectations were not met: '%s'", err)
+		}
+	})
+}
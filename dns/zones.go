@@ -0,0 +1,200 @@
+package dns
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"regexp"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+// Error definitions
+var ErrorInvalidZone = errors.New("zone configuration requires a name and a suffix")
+var ErrorDuplicateZone = errors.New("zone configuration contains a duplicate zone name")
+var ErrorInvalidSeverity = errors.New("zone configuration contains an invalid return code severity")
+
+// Zone describes a DNS blocklist zone that IPs are checked against
+type Zone struct {
+	// Name uniquely identifies the zone and is stored alongside each result
+	Name string
+	// Suffix is the DNS suffix queried for the zone, e.g. zen.spamhaus.org
+	Suffix string
+	// Enabled determines whether enqueued IPs are checked against the zone
+	Enabled bool
+	// ExpectedResponsePattern validates the response codes returned by the zone
+	ExpectedResponsePattern *regexp.Regexp
+	// IPv6 determines whether the zone lists IPv6 addresses
+	IPv6 bool
+	// ReturnCodes decodes response codes into listings. If nil, the built-in table for the suffix is used
+	ReturnCodes ReturnCodeTable
+}
+
+// zoneConfig is the JSON representation of a zone in the zone configuration file
+type zoneConfig struct {
+	Name                    string                `json:"name"`
+	Suffix                  string                `json:"suffix"`
+	Enabled                 *bool                 `json:"enabled"`
+	IPv6                    bool                  `json:"ipv6"`
+	ExpectedResponsePattern string                `json:"expected_response_pattern"`
+	ReturnCodes             map[string]codeConfig `json:"return_codes"`
+}
+
+// codeConfig is the JSON representation of a zone's return code
+type codeConfig struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Severity    string `json:"severity"`
+}
+
+// DefaultZones is used when no zone configuration file is provided
+var DefaultZones = []Zone{
+	{
+		Name:                    "spamhaus-zen",
+		Suffix:                  "zen.spamhaus.org",
+		Enabled:                 true,
+		IPv6:                    true,
+		ExpectedResponsePattern: ExpectedResponsePattern,
+	},
+}
+
+// Registry holds the set of configured blocklist zones
+type Registry struct {
+	zones []Zone
+}
+
+// NewRegistry creates a registry from the given zones
+func NewRegistry(zones []Zone) (*Registry, error) {
+	names := map[string]bool{}
+
+	for _, zone := range zones {
+		if zone.Name == "" || zone.Suffix == "" {
+			return nil, ErrorInvalidZone
+		}
+
+		// Zone names are used to identify results, so they must be unique
+		if names[zone.Name] {
+			return nil, ErrorDuplicateZone
+		}
+		names[zone.Name] = true
+	}
+
+	return &Registry{zones: zones}, nil
+}
+
+// LoadRegistry reads the zone configuration file at the given path. If no path is given,
+// the default zones are used.
+func LoadRegistry(path string) (*Registry, error) {
+	if path == "" {
+		return NewRegistry(DefaultZones)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	zones, err := ParseZones(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRegistry(zones)
+}
+
+// ParseZones parses a JSON list of zone configurations
+func ParseZones(data []byte) ([]Zone, error) {
+	configs := []zoneConfig{}
+	err := json.Unmarshal(data, &configs)
+	if err != nil {
+		return nil, err
+	}
+
+	zones := []Zone{}
+	for _, config := range configs {
+		zone := Zone{
+			Name:                    config.Name,
+			Suffix:                  config.Suffix,
+			Enabled:                 true,
+			IPv6:                    config.IPv6,
+			ExpectedResponsePattern: ExpectedResponsePattern,
+		}
+
+		// Zones are enabled unless explicitly disabled
+		if config.Enabled != nil {
+			zone.Enabled = *config.Enabled
+		}
+
+		// Fall back to the default pattern if the zone does not specify one
+		if config.ExpectedResponsePattern != "" {
+			pattern, err := regexp.Compile(config.ExpectedResponsePattern)
+			if err != nil {
+				return nil, err
+			}
+			zone.ExpectedResponsePattern = pattern
+		}
+
+		// Build the zone's own return code table if it specifies one
+		if config.ReturnCodes != nil {
+			zone.ReturnCodes = ReturnCodeTable{}
+			for code, codeConfig := range config.ReturnCodes {
+				severity := model.Severity(codeConfig.Severity)
+				if !severity.IsValid() {
+					return nil, ErrorInvalidSeverity
+				}
+
+				zone.ReturnCodes[code] = model.Listing{
+					Name:        codeConfig.Name,
+					Description: codeConfig.Description,
+					Severity:    severity,
+				}
+			}
+		}
+
+		zones = append(zones, zone)
+	}
+
+	return zones, nil
+}
+
+// Supports checks whether the zone lists addresses of the given IP's family
+func (z Zone) Supports(ip net.IP) bool {
+	return ip.To4() != nil || z.IPv6
+}
+
+// Zones returns every configured zone
+func (r *Registry) Zones() []Zone {
+	return r.zones
+}
+
+// Enabled returns the zones that enqueued IPs should be checked against
+func (r *Registry) Enabled() []Zone {
+	enabled := []Zone{}
+	for _, zone := range r.zones {
+		if zone.Enabled {
+			enabled = append(enabled, zone)
+		}
+	}
+	return enabled
+}
+
+// Supports checks whether any enabled zone lists addresses of the given IP's family
+func (r *Registry) Supports(ip net.IP) bool {
+	for _, zone := range r.Enabled() {
+		if zone.Supports(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get returns the zone with the given name
+func (r *Registry) Get(name string) (Zone, bool) {
+	for _, zone := range r.zones {
+		if zone.Name == name {
+			return zone, true
+		}
+	}
+	return Zone{}, false
+}
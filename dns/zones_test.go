@@ -0,0 +1,219 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+)
+
+func TestParseZones(t *testing.T) {
+	type input struct {
+		config string
+	}
+	type want struct {
+		err     bool
+		zones   int
+		enabled bool
+		matches string
+	}
+
+	tests := []struct {
+		description string
+		input       input
+		want        want
+	}{
+		{
+			description: "should parse zone configuration",
+			input: input{
+				config: `[{"name": "spamcop", "suffix": "bl.spamcop.net", "enabled": true, "expected_response_pattern": "^127\\.0\\.0\\.2$"}]`,
+			},
+			want: want{
+				zones:   1,
+				enabled: true,
+				matches: "127.0.0.2",
+			},
+		},
+		{
+			description: "should enable zones and use the default pattern if not configured",
+			input: input{
+				config: `[{"name": "spamhaus-zen", "suffix": "zen.spamhaus.org"}]`,
+			},
+			want: want{
+				zones:   1,
+				enabled: true,
+				matches: "127.0.0.4",
+			},
+		},
+		{
+			description: "should parse disabled zones",
+			input: input{
+				config: `[{"name": "sorbs", "suffix": "dnsbl.sorbs.net", "enabled": false}]`,
+			},
+			want: want{
+				zones:   1,
+				matches: "127.0.0.4",
+			},
+		},
+		{
+			description: "should return error for invalid pattern",
+			input: input{
+				config: `[{"name": "sorbs", "suffix": "dnsbl.sorbs.net", "expected_response_pattern": "("}]`,
+			},
+			want: want{
+				err: true,
+			},
+		},
+		{
+			description: "should return error for invalid return code severity",
+			input: input{
+				config: `[{"name": "internal", "suffix": "bl.example.com", "return_codes": {"127.0.0.2": {"name": "INTERNAL", "severity": "SEVERE"}}}]`,
+			},
+			want: want{
+				err: true,
+			},
+		},
+		{
+			description: "should return error for invalid JSON",
+			input: input{
+				config: `{`,
+			},
+			want: want{
+				err: true,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := ParseZones([]byte(test.input.config))
+
+			// Check error
+			if test.want.err {
+				if err == nil {
+					t.Fatal("didn't get an error but wanted one")
+				}
+				return
+			}
+			assertError(t, err, nil)
+
+			// Check zones
+			if len(got) != test.want.zones {
+				t.Fatalf("got %d zones, want %d", len(got), test.want.zones)
+			}
+			if got[0].Enabled != test.want.enabled {
+				t.Errorf("got enabled %v, want %v", got[0].Enabled, test.want.enabled)
+			}
+			if !got[0].ExpectedResponsePattern.MatchString(test.want.matches) {
+				t.Errorf("pattern %s did not match %s", got[0].ExpectedResponsePattern, test.want.matches)
+			}
+		})
+	}
+
+	t.Run("should parse zone return codes", func(t *testing.T) {
+		zones, err := ParseZones([]byte(`[{"name": "internal", "suffix": "bl.example.com", "return_codes": {"127.0.0.2": {"name": "INTERNAL", "description": "internal", "severity": "HIGH"}}}]`))
+		assertError(t, err, nil)
+
+		listing := zones[0].ReturnCodes["127.0.0.2"]
+		if listing.Name != "INTERNAL" || listing.Severity != model.SeverityHigh {
+			t.Errorf("got %v, want INTERNAL listing", listing)
+		}
+	})
+}
+
+func TestNewRegistry(t *testing.T) {
+	type input struct {
+		zones []Zone
+	}
+	type want struct {
+		err     error
+		enabled int
+	}
+
+	tests := []struct {
+		description string
+		input       input
+		want        want
+	}{
+		{
+			description: "should return enabled zones",
+			input: input{
+				zones: []Zone{
+					{Name: "spamhaus-zen", Suffix: "zen.spamhaus.org", Enabled: true},
+					{Name: "spamcop", Suffix: "bl.spamcop.net", Enabled: true},
+					{Name: "sorbs", Suffix: "dnsbl.sorbs.net"},
+				},
+			},
+			want: want{
+				enabled: 2,
+			},
+		},
+		{
+			description: "should return error for zone without suffix",
+			input: input{
+				zones: []Zone{{Name: "spamhaus-zen"}},
+			},
+			want: want{
+				err: ErrorInvalidZone,
+			},
+		},
+		{
+			description: "should return error for duplicate zone names",
+			input: input{
+				zones: []Zone{
+					{Name: "spamhaus-zen", Suffix: "zen.spamhaus.org"},
+					{Name: "spamhaus-zen", Suffix: "sbl.spamhaus.org"},
+				},
+			},
+			want: want{
+				err: ErrorDuplicateZone,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := NewRegistry(test.input.zones)
+
+			// Check error
+			assertError(t, err, test.want.err)
+
+			// Check enabled zones
+			if err == nil && len(got.Enabled()) != test.want.enabled {
+				t.Errorf("got %d enabled zones, want %d", len(got.Enabled()), test.want.enabled)
+			}
+		})
+	}
+
+	t.Run("should check address family support", func(t *testing.T) {
+		registry, err := NewRegistry([]Zone{
+			{Name: "spamcop", Suffix: "bl.spamcop.net", Enabled: true},
+			{Name: "spamhaus-zen", Suffix: "zen.spamhaus.org", IPv6: true},
+		})
+		assertError(t, err, nil)
+
+		if !registry.Supports(net.ParseIP("1.2.3.4")) {
+			t.Error("IPv4 address should be supported")
+		}
+
+		// The only IPv6 capable zone is disabled
+		if registry.Supports(net.ParseIP("2001:db8::1")) {
+			t.Error("IPv6 address should not be supported")
+		}
+	})
+
+	t.Run("should get zone by name", func(t *testing.T) {
+		registry, err := NewRegistry(DefaultZones)
+		assertError(t, err, nil)
+
+		zone, ok := registry.Get("spamhaus-zen")
+		if !ok || zone.Suffix != "zen.spamhaus.org" {
+			t.Errorf("got %v, want zone spamhaus-zen", zone)
+		}
+
+		_, ok = registry.Get("unknown")
+		if ok {
+			t.Error("got zone for unknown name")
+		}
+	})
+}
@@ -6,6 +6,7 @@ require (
 	github.com/99designs/gqlgen v0.13.0
 	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/go-chi/chi v3.3.2+incompatible
+	github.com/lib/pq v1.10.0
 	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/satori/go.uuid v1.2.0
 	github.com/vektah/gqlparser/v2 v2.1.0
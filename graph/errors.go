@@ -0,0 +1,86 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/grantsavage/ip-lookup-api/db"
+	"github.com/grantsavage/ip-lookup-api/graph/model"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Error codes returned as extensions.code of each GraphQL error
+const (
+	ErrorCodeInvalidIP       = "INVALID_IP"
+	ErrorCodeNotFound        = "NOT_FOUND"
+	ErrorCodeInvalidArgument = "INVALID_ARGUMENT"
+	ErrorCodeInternal        = "INTERNAL"
+)
+
+// errorCodes maps the errors that are safe to show to clients to their error codes
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{model.ErrorInvalidIPAddress, ErrorCodeInvalidIP},
+	{db.ErrorNotFound, ErrorCodeNotFound},
+	{db.ErrorJobNotFound, ErrorCodeNotFound},
+	{model.ErrorInvalidDateTime, ErrorCodeInvalidArgument},
+	{db.ErrorInvalidCursor, ErrorCodeInvalidArgument},
+	{db.ErrorInvalidPageSize, ErrorCodeInvalidArgument},
+	{db.ErrorInvalidCIDR, ErrorCodeInvalidArgument},
+	{db.ErrorNetworkTooLarge, ErrorCodeInvalidArgument},
+	{db.ErrorBatchTooLarge, ErrorCodeInvalidArgument},
+}
+
+// errorCode returns the code of an error that is safe to show to clients
+func errorCode(err error) (string, bool) {
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			return known.code, true
+		}
+	}
+	return "", false
+}
+
+// setDetailsError records why an entry of a batch has no results, with the same message and
+// code the error would have if it failed the whole request
+func setDetailsError(entry *model.IPDetails, err error) {
+	message := err.Error()
+	code, _ := errorCode(err)
+	entry.Error = &message
+	entry.Code = &code
+}
+
+// ErrorPresenter adds a machine-readable code to each error returned to clients. Errors that
+// are not known to be safe to show, such as failed SQL queries, are logged and replaced by a
+// generic internal error.
+func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	var presented *gqlerror.Error
+	if !errors.As(err, &presented) {
+		presented = gqlerror.WrapPath(graphql.GetPath(ctx), err)
+	}
+
+	// Errors raised by gqlgen itself, such as failed validation, already carry a code
+	if _, ok := presented.Extensions["code"]; ok {
+		return presented
+	}
+
+	if code, ok := errorCode(err); ok {
+		if presented.Extensions == nil {
+			presented.Extensions = map[string]interface{}{}
+		}
+		presented.Extensions["code"] = code
+		return presented
+	}
+
+	log.Printf("internal error at %s: %s", presented.Path, err)
+	return &gqlerror.Error{
+		Message:    "internal server error",
+		Path:       presented.Path,
+		Locations:  presented.Locations,
+		Extensions: map[string]interface{}{"code": ErrorCodeInternal},
+	}
+}
@@ -0,0 +1,61 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/grantsavage/ip-lookup-api/db"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestErrorPresenter(t *testing.T) {
+	tests := []struct {
+		description string
+		err         error
+		wantMessage string
+		wantCode    string
+	}{
+		{
+			description: "should add code of known error",
+			err:         db.ErrorNotFound,
+			wantMessage: db.ErrorNotFound.Error(),
+			wantCode:    ErrorCodeNotFound,
+		},
+		{
+			description: "should add code of wrapped known error",
+			err:         fmt.Errorf("resultsInNetwork: %w", db.ErrorInvalidCIDR),
+			wantMessage: "resultsInNetwork: " + db.ErrorInvalidCIDR.Error(),
+			wantCode:    ErrorCodeInvalidArgument,
+		},
+		{
+			description: "should keep code of error raised by gqlgen",
+			err: &gqlerror.Error{
+				Message:    "Cannot query field \"foo\" on type \"Query\".",
+				Extensions: map[string]interface{}{"code": "GRAPHQL_VALIDATION_FAILED"},
+			},
+			wantMessage: "Cannot query field \"foo\" on type \"Query\".",
+			wantCode:    "GRAPHQL_VALIDATION_FAILED",
+		},
+		{
+			description: "should hide unknown error",
+			err:         errors.New("no such table: address_results"),
+			wantMessage: "internal server error",
+			wantCode:    ErrorCodeInternal,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got := ErrorPresenter(context.Background(), test.err)
+
+			if got.Message != test.wantMessage {
+				t.Errorf("got message %q, want %q", got.Message, test.wantMessage)
+			}
+			if got.Extensions["code"] != test.wantCode {
+				t.Errorf("got code %v, want %q", got.Extensions["code"], test.wantCode)
+			}
+		})
+	}
+}
@@ -2,10 +2,475 @@
 
 package model
 
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+type EnqueuePayload struct {
+	Job     *Job             `json:"job"`
+	Results []*EnqueueResult `json:"results"`
+}
+
+type EnqueueResult struct {
+	Input     string        `json:"input"`
+	IPAddress net.IP        `json:"ip_address"`
+	Status    EnqueueStatus `json:"status"`
+	Count     int           `json:"count"`
+}
+
+type IPDetails struct {
+	IP      string            `json:"ip"`
+	Results []*IPLookupResult `json:"results"`
+	Error   *string           `json:"error"`
+	Code    *string           `json:"code"`
+}
+
 type IPLookupResult struct {
-	UUID         string `json:"uuid"`
-	IPAddress    string `json:"ip_address"`
-	ResponseCode string `json:"response_code"`
-	CreatedAt    string `json:"created_at"`
-	UpdatedAt    string `json:"updated_at"`
+	UUID         string                   `json:"uuid"`
+	IPAddress    net.IP                   `json:"ip_address"`
+	Zone         string                   `json:"zone"`
+	Status       LookupStatus             `json:"status"`
+	ResponseCode *string                  `json:"response_code"`
+	ErrorClass   *DNSErrorClass           `json:"error_class"`
+	Listings     []*Listing               `json:"listings"`
+	Reason       *string                  `json:"reason"`
+	Warning      *string                  `json:"warning"`
+	History      *LookupHistoryConnection `json:"history"`
+	CreatedAt    time.Time                `json:"created_at"`
+	UpdatedAt    time.Time                `json:"updated_at"`
+}
+
+type Job struct {
+	ID         string     `json:"id"`
+	State      JobState   `json:"state"`
+	Submitted  int        `json:"submitted"`
+	Pending    int        `json:"pending"`
+	Processing int        `json:"processing"`
+	Done       int        `json:"done"`
+	Failed     int        `json:"failed"`
+	Items      []*JobItem `json:"items"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type JobItem struct {
+	IPAddress net.IP       `json:"ip_address"`
+	State     JobItemState `json:"state"`
+	Error     *string      `json:"error"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+type Listing struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Severity    Severity `json:"severity"`
+}
+
+type ListingEvent struct {
+	ID                   string           `json:"id"`
+	IPAddress            net.IP           `json:"ip_address"`
+	Zone                 string           `json:"zone"`
+	Type                 ListingEventType `json:"type"`
+	PreviousResponseCode *string          `json:"previous_response_code"`
+	ResponseCode         *string          `json:"response_code"`
+	CreatedAt            time.Time        `json:"created_at"`
+}
+
+type LookupHistoryConnection struct {
+	Edges    []*LookupHistoryEdge `json:"edges"`
+	PageInfo *PageInfo            `json:"pageInfo"`
+}
+
+type LookupHistoryEdge struct {
+	Cursor string              `json:"cursor"`
+	Node   *LookupHistoryEntry `json:"node"`
+}
+
+type LookupHistoryEntry struct {
+	Zone         string         `json:"zone"`
+	Status       LookupStatus   `json:"status"`
+	ResponseCode *string        `json:"response_code"`
+	ErrorClass   *DNSErrorClass `json:"error_class"`
+	CheckedAt    time.Time      `json:"checked_at"`
+}
+
+type LookupResultConnection struct {
+	Edges    []*LookupResultEdge `json:"edges"`
+	PageInfo *PageInfo           `json:"pageInfo"`
+}
+
+type LookupResultEdge struct {
+	Cursor string          `json:"cursor"`
+	Node   *IPLookupResult `json:"node"`
+}
+
+type LookupResultFilter struct {
+	Status       *LookupStatus `json:"status"`
+	ResponseCode *string       `json:"response_code"`
+	UpdatedSince *time.Time    `json:"updated_since"`
+	Cidr         *string       `json:"cidr"`
+}
+
+type NetworkResults struct {
+	Cidr    string            `json:"cidr"`
+	Summary *NetworkSummary   `json:"summary"`
+	Results []*IPLookupResult `json:"results"`
+}
+
+type NetworkSummary struct {
+	Checked int `json:"checked"`
+	Listed  int `json:"listed"`
+	Clean   int `json:"clean"`
+}
+
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor"`
+}
+
+type PurgeResult struct {
+	Results int `json:"results"`
+	History int `json:"history"`
+	Events  int `json:"events"`
+	Jobs    int `json:"jobs"`
+}
+
+type ZoneHealth struct {
+	Zone           string         `json:"zone"`
+	Healthy        bool           `json:"healthy"`
+	Warning        *string        `json:"warning"`
+	LastErrorClass *DNSErrorClass `json:"last_error_class"`
+	LastErrorAt    *time.Time     `json:"last_error_at"`
+}
+
+type DNSErrorClass string
+
+const (
+	DNSErrorClassNxdomain           DNSErrorClass = "NXDOMAIN"
+	DNSErrorClassServfail           DNSErrorClass = "SERVFAIL"
+	DNSErrorClassTimeout            DNSErrorClass = "TIMEOUT"
+	DNSErrorClassNoResponse         DNSErrorClass = "NO_RESPONSE"
+	DNSErrorClassUnexpectedResponse DNSErrorClass = "UNEXPECTED_RESPONSE"
+	DNSErrorClassMalformedQuery     DNSErrorClass = "MALFORMED_QUERY"
+	DNSErrorClassPublicResolver     DNSErrorClass = "PUBLIC_RESOLVER"
+	DNSErrorClassRateLimited        DNSErrorClass = "RATE_LIMITED"
+	DNSErrorClassZoneRefused        DNSErrorClass = "ZONE_REFUSED"
+	DNSErrorClassUnknown            DNSErrorClass = "UNKNOWN"
+)
+
+var AllDNSErrorClass = []DNSErrorClass{
+	DNSErrorClassNxdomain,
+	DNSErrorClassServfail,
+	DNSErrorClassTimeout,
+	DNSErrorClassNoResponse,
+	DNSErrorClassUnexpectedResponse,
+	DNSErrorClassMalformedQuery,
+	DNSErrorClassPublicResolver,
+	DNSErrorClassRateLimited,
+	DNSErrorClassZoneRefused,
+	DNSErrorClassUnknown,
+}
+
+func (e DNSErrorClass) IsValid() bool {
+	switch e {
+	case DNSErrorClassNxdomain, DNSErrorClassServfail, DNSErrorClassTimeout, DNSErrorClassNoResponse, DNSErrorClassUnexpectedResponse, DNSErrorClassMalformedQuery, DNSErrorClassPublicResolver, DNSErrorClassRateLimited, DNSErrorClassZoneRefused, DNSErrorClassUnknown:
+		return true
+	}
+	return false
+}
+
+func (e DNSErrorClass) String() string {
+	return string(e)
+}
+
+func (e *DNSErrorClass) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = DNSErrorClass(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid DNSErrorClass", str)
+	}
+	return nil
+}
+
+func (e DNSErrorClass) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type EnqueueStatus string
+
+const (
+	EnqueueStatusAccepted      EnqueueStatus = "ACCEPTED"
+	EnqueueStatusInvalid       EnqueueStatus = "INVALID"
+	EnqueueStatusDuplicate     EnqueueStatus = "DUPLICATE"
+	EnqueueStatusUnsupported   EnqueueStatus = "UNSUPPORTED"
+	EnqueueStatusTooLarge      EnqueueStatus = "TOO_LARGE"
+	EnqueueStatusLimitExceeded EnqueueStatus = "LIMIT_EXCEEDED"
+)
+
+var AllEnqueueStatus = []EnqueueStatus{
+	EnqueueStatusAccepted,
+	EnqueueStatusInvalid,
+	EnqueueStatusDuplicate,
+	EnqueueStatusUnsupported,
+	EnqueueStatusTooLarge,
+	EnqueueStatusLimitExceeded,
+}
+
+func (e EnqueueStatus) IsValid() bool {
+	switch e {
+	case EnqueueStatusAccepted, EnqueueStatusInvalid, EnqueueStatusDuplicate, EnqueueStatusUnsupported, EnqueueStatusTooLarge, EnqueueStatusLimitExceeded:
+		return true
+	}
+	return false
+}
+
+func (e EnqueueStatus) String() string {
+	return string(e)
+}
+
+func (e *EnqueueStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = EnqueueStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid EnqueueStatus", str)
+	}
+	return nil
+}
+
+func (e EnqueueStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type JobItemState string
+
+const (
+	JobItemStatePending    JobItemState = "PENDING"
+	JobItemStateProcessing JobItemState = "PROCESSING"
+	JobItemStateDone       JobItemState = "DONE"
+	JobItemStateFailed     JobItemState = "FAILED"
+)
+
+var AllJobItemState = []JobItemState{
+	JobItemStatePending,
+	JobItemStateProcessing,
+	JobItemStateDone,
+	JobItemStateFailed,
+}
+
+func (e JobItemState) IsValid() bool {
+	switch e {
+	case JobItemStatePending, JobItemStateProcessing, JobItemStateDone, JobItemStateFailed:
+		return true
+	}
+	return false
+}
+
+func (e JobItemState) String() string {
+	return string(e)
+}
+
+func (e *JobItemState) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = JobItemState(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid JobItemState", str)
+	}
+	return nil
+}
+
+func (e JobItemState) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type JobState string
+
+const (
+	JobStatePending    JobState = "PENDING"
+	JobStateProcessing JobState = "PROCESSING"
+	JobStateCompleted  JobState = "COMPLETED"
+	JobStateFailed     JobState = "FAILED"
+)
+
+var AllJobState = []JobState{
+	JobStatePending,
+	JobStateProcessing,
+	JobStateCompleted,
+	JobStateFailed,
+}
+
+func (e JobState) IsValid() bool {
+	switch e {
+	case JobStatePending, JobStateProcessing, JobStateCompleted, JobStateFailed:
+		return true
+	}
+	return false
+}
+
+func (e JobState) String() string {
+	return string(e)
+}
+
+func (e *JobState) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = JobState(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid JobState", str)
+	}
+	return nil
+}
+
+func (e JobState) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ListingEventType string
+
+const (
+	ListingEventTypeListed      ListingEventType = "LISTED"
+	ListingEventTypeDelisted    ListingEventType = "DELISTED"
+	ListingEventTypeCodeChanged ListingEventType = "CODE_CHANGED"
+)
+
+var AllListingEventType = []ListingEventType{
+	ListingEventTypeListed,
+	ListingEventTypeDelisted,
+	ListingEventTypeCodeChanged,
+}
+
+func (e ListingEventType) IsValid() bool {
+	switch e {
+	case ListingEventTypeListed, ListingEventTypeDelisted, ListingEventTypeCodeChanged:
+		return true
+	}
+	return false
+}
+
+func (e ListingEventType) String() string {
+	return string(e)
+}
+
+func (e *ListingEventType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ListingEventType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ListingEventType", str)
+	}
+	return nil
+}
+
+func (e ListingEventType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type LookupStatus string
+
+const (
+	LookupStatusListed    LookupStatus = "LISTED"
+	LookupStatusNotListed LookupStatus = "NOT_LISTED"
+	LookupStatusError     LookupStatus = "ERROR"
+	LookupStatusZoneError LookupStatus = "ZONE_ERROR"
+)
+
+var AllLookupStatus = []LookupStatus{
+	LookupStatusListed,
+	LookupStatusNotListed,
+	LookupStatusError,
+	LookupStatusZoneError,
+}
+
+func (e LookupStatus) IsValid() bool {
+	switch e {
+	case LookupStatusListed, LookupStatusNotListed, LookupStatusError, LookupStatusZoneError:
+		return true
+	}
+	return false
+}
+
+func (e LookupStatus) String() string {
+	return string(e)
+}
+
+func (e *LookupStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = LookupStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid LookupStatus", str)
+	}
+	return nil
+}
+
+func (e LookupStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type Severity string
+
+const (
+	SeverityLow      Severity = "LOW"
+	SeverityMedium   Severity = "MEDIUM"
+	SeverityHigh     Severity = "HIGH"
+	SeverityCritical Severity = "CRITICAL"
+)
+
+var AllSeverity = []Severity{
+	SeverityLow,
+	SeverityMedium,
+	SeverityHigh,
+	SeverityCritical,
+}
+
+func (e Severity) IsValid() bool {
+	switch e {
+	case SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical:
+		return true
+	}
+	return false
+}
+
+func (e Severity) String() string {
+	return string(e)
+}
+
+func (e *Severity) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Severity(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Severity", str)
+	}
+	return nil
+}
+
+func (e Severity) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
 }
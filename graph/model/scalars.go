@@ -0,0 +1,60 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+)
+
+// Error definitions
+var ErrorInvalidIPAddress = errors.New("IPAddress must be an IPv4 or IPv6 address")
+var ErrorInvalidDateTime = errors.New("DateTime must be an RFC 3339 timestamp")
+
+// MarshalIPAddress marshals an IP in its canonical form, e.g. 2001:db8::1
+func MarshalIPAddress(ip net.IP) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		io.WriteString(w, strconv.Quote(ip.String()))
+	})
+}
+
+// UnmarshalIPAddress unmarshals an IPv4 or IPv6 address, rejecting anything else
+func UnmarshalIPAddress(v interface{}) (net.IP, error) {
+	value, ok := v.(string)
+	if !ok {
+		return nil, ErrorInvalidIPAddress
+	}
+
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return nil, fmt.Errorf("%w: %q", ErrorInvalidIPAddress, value)
+	}
+
+	return ip, nil
+}
+
+// MarshalDateTime marshals a timestamp in RFC 3339 format, in UTC
+func MarshalDateTime(t time.Time) graphql.Marshaler {
+	return graphql.WriterFunc(func(w io.Writer) {
+		io.WriteString(w, strconv.Quote(t.UTC().Format(time.RFC3339)))
+	})
+}
+
+// UnmarshalDateTime unmarshals an RFC 3339 timestamp, e.g. 2021-03-01T00:00:00Z
+func UnmarshalDateTime(v interface{}) (time.Time, error) {
+	value, ok := v.(string)
+	if !ok {
+		return time.Time{}, ErrorInvalidDateTime
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrorInvalidDateTime, value)
+	}
+
+	return t, nil
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalIPAddress(t *testing.T) {
+	tests := []struct {
+		description string
+		input       interface{}
+		want        string
+		wantErr     error
+	}{
+		{
+			description: "should unmarshal IPv4 address",
+			input:       "1.2.3.4",
+			want:        "1.2.3.4",
+		},
+		{
+			description: "should unmarshal IPv6 address",
+			input:       "2001:0db8:0000:0000:0000:0000:0000:0001",
+			want:        "2001:db8::1",
+		},
+		{
+			description: "should reject invalid address",
+			input:       "1.2.3.256",
+			wantErr:     ErrorInvalidIPAddress,
+		},
+		{
+			description: "should reject non-string input",
+			input:       1234,
+			wantErr:     ErrorInvalidIPAddress,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			ip, err := UnmarshalIPAddress(test.input)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error '%v', wanted '%v'", err, test.wantErr)
+			}
+			if test.wantErr == nil && ip.String() != test.want {
+				t.Errorf("got %s, want %s", ip, test.want)
+			}
+		})
+	}
+}
+
+func TestMarshalIPAddress(t *testing.T) {
+	t.Run("should marshal IPv6 address in canonical form", func(t *testing.T) {
+		ip, err := UnmarshalIPAddress("2001:DB8:0:0:0:0:0:1")
+		if err != nil {
+			t.Fatalf("error: '%s'", err)
+		}
+
+		var buf bytes.Buffer
+		MarshalIPAddress(ip).MarshalGQL(&buf)
+		if buf.String() != `"2001:db8::1"` {
+			t.Errorf("got %s, want \"2001:db8::1\"", buf.String())
+		}
+	})
+}
+
+func TestUnmarshalDateTime(t *testing.T) {
+	tests := []struct {
+		description string
+		input       interface{}
+		want        time.Time
+		wantErr     error
+	}{
+		{
+			description: "should unmarshal RFC 3339 timestamp",
+			input:       "2021-03-01T07:00:00-05:00",
+			want:        time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			description: "should reject other formats",
+			input:       "2021-03-01 07:00:00",
+			wantErr:     ErrorInvalidDateTime,
+		},
+		{
+			description: "should reject non-string input",
+			input:       1614600000,
+			wantErr:     ErrorInvalidDateTime,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			got, err := UnmarshalDateTime(test.input)
+			if !errors.Is(err, test.wantErr) {
+				t.Fatalf("got error '%v', wanted '%v'", err, test.wantErr)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMarshalDateTime(t *testing.T) {
+	t.Run("should marshal timestamp in UTC", func(t *testing.T) {
+		timestamp := time.Date(2021, 3, 1, 7, 0, 0, 0, time.FixedZone("EST", -5*60*60))
+
+		var buf bytes.Buffer
+		MarshalDateTime(timestamp).MarshalGQL(&buf)
+		if buf.String() != `"2021-03-01T12:00:00Z"` {
+			t.Errorf("got %s, want \"2021-03-01T12:00:00Z\"", buf.String())
+		}
+	})
+}
@@ -1,10 +1,27 @@
 package graph
 
-import "database/sql"
+import (
+	"github.com/grantsavage/ip-lookup-api/db"
+	"github.com/grantsavage/ip-lookup-api/dns"
+)
 
 //go:generate go run github.com/99designs/gqlgen
 
 type Resolver struct {
-	// Database holds a pointer to the database connection
-	Database *sql.DB
+	// Store holds the storage backend of lookup results and jobs
+	Store db.Store
+	// Zones holds the registry of configured blocklist zones
+	Zones *dns.Registry
+	// Lookup configures how blocklist lookups are performed
+	Lookup dns.LookupConfig
+	// Pool holds the workers that look up enqueued IPs
+	Pool *dns.Pool
+	// Purger deletes stored data that is older than the retention policy
+	Purger *db.Purger
+	// MaxRangeBits limits the size of enqueued CIDR ranges to this many host bits
+	MaxRangeBits int
+	// MaxNetworkRangeBits limits the size of networks whose results are returned at once
+	MaxNetworkRangeBits int
+	// MaxEnqueueAddresses limits the number of IPs a single enqueue request adds to a job
+	MaxEnqueueAddresses int
 }
@@ -5,9 +5,9 @@ package graph
 
 import (
 	"context"
-	"errors"
 	"log"
 	"net"
+	"time"
 
 	"github.com/grantsavage/ip-lookup-api/db"
 	"github.com/grantsavage/ip-lookup-api/dns"
@@ -15,50 +15,262 @@ import (
 	"github.com/grantsavage/ip-lookup-api/graph/model"
 )
 
-// Enqueue looks up and stores the response codes of a given list of IPs
-func (r *mutationResolver) Enqueue(ctx context.Context, ips []string) ([]string, error) {
+func (r *iPLookupResultResolver) Listings(ctx context.Context, obj *model.IPLookupResult) ([]*model.Listing, error) {
+	// Only listed results have a response code to decode
+	if obj.Status != model.LookupStatusListed || obj.ResponseCode == nil {
+		return []*model.Listing{}, nil
+	}
+
+	// The response codes of zones that were since removed from the configuration are unknown,
+	// so their results are only reported as listed for an unknown reason
+	zone, ok := r.Zones.Get(obj.Zone)
+	if !ok {
+		zone = dns.Zone{Name: obj.Zone}
+	}
+
+	return dns.DecodeResponseCode(zone, *obj.ResponseCode), nil
+}
+
+// Warning warns that a clean result may be unreliable while its zone is refusing queries
+func (r *iPLookupResultResolver) Warning(ctx context.Context, obj *model.IPLookupResult) (*string, error) {
+	if obj.Status != model.LookupStatusNotListed || r.Lookup.Health == nil {
+		return nil, nil
+	}
+
+	return r.Lookup.Health.Warning(obj.Zone), nil
+}
+
+// History pages through every check of the result's IP against its zone, most recent first
+func (r *iPLookupResultResolver) History(ctx context.Context, obj *model.IPLookupResult, first *int, after *string) (*model.LookupHistoryConnection, error) {
+	pageSize := db.DefaultPageSize
+	if first != nil {
+		pageSize = *first
+	}
+
+	history, err := r.Store.GetLookupHistory(obj.IPAddress, obj.Zone, pageSize, after)
+	if err != nil {
+		log.Printf("error while retrieving lookup history: %s", err)
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// Items lists the outcome of each IP of the job, optionally only those in the given state
+func (r *jobResolver) Items(ctx context.Context, obj *model.Job, state *model.JobItemState) ([]*model.JobItem, error) {
+	items, err := r.Store.GetJobItems(obj.ID, state)
+	if err != nil {
+		log.Printf("error while retrieving job items: %s", err)
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// Enqueue stores the valid IPs and the addresses of valid CIDR ranges as a single job and reports
+// whether each input was accepted, so that a single bad entry does not reject a whole batch
+func (r *mutationResolver) Enqueue(ctx context.Context, ips []string) (*model.EnqueuePayload, error) {
 	log.Printf("Mutation.Enqueue invoked for %d IP(s)", len(ips))
 
-	// Validate the list of IPs
-	validIPs, err := dns.ValidateIPs(ips)
+	// Validate IP inputs, keeping only those that can be looked up
+	results, validIPs := dns.ValidateIPs(ips, r.Zones, r.MaxRangeBits, r.MaxEnqueueAddresses)
+	payload := &model.EnqueuePayload{Results: results}
+	if len(validIPs) == 0 {
+		return payload, nil
+	}
+
+	// Store the IPs as a job, which the worker pool looks up in the background
+	jobID, err := r.Pool.Enqueue(validIPs)
 	if err != nil {
-		log.Printf("error while validating IP addresses: %s", err)
+		log.Printf("error while enqueueing IP addresses: %s", err)
 		return nil, err
 	}
 
-	/* Kick off a background worker to process IPs. Ideally if this system were
-	 * to receive a high amount of requests, I would batch the IPs and kick off a worker
-	 * for each batch of IPs to improve the concurrency. */
-	go dns.BlocklistWorker(r.Database, validIPs)
+	// Return the job so callers can track its progress
+	payload.Job, err = r.Store.GetJob(jobID)
+	if err != nil {
+		log.Printf("error while retrieving job: %s", err)
+		return nil, err
+	}
 
-	return ips, nil
+	return payload, nil
 }
 
-// GetIPDetails fetches the lookup details of a given IP
-func (r *queryResolver) GetIPDetails(ctx context.Context, ip string) (*model.IPLookupResult, error) {
+// Purge deletes the stored data that is older than the retention policy right away
+func (r *mutationResolver) Purge(ctx context.Context) (*model.PurgeResult, error) {
+	log.Printf("Mutation.Purge invoked")
+
+	result, err := r.Purger.Purge()
+	if err != nil {
+		log.Printf("error while purging expired data: %s", err)
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *queryResolver) GetIPDetails(ctx context.Context, ip net.IP) ([]*model.IPLookupResult, error) {
 	log.Printf("Query.GetIPDetails invoked for IP: %s", ip)
 
-	// Validate IP input
-	validIp := net.ParseIP(ip)
-	if validIp == nil {
-		return nil, errors.New("Provided IP " + ip + " is not a valid IP.")
+	// Retrieve the lookup results of each zone from the database
+	results, err := r.Store.GetIPLookupResults(ip)
+	if err != nil {
+		log.Printf("error while retrieving lookup results: %s", err)
+		return nil, err
 	}
 
-	// Retrieve the lookup result from the database
-	result, err := db.GetIPLookupResult(r.Database, validIp)
+	return results, nil
+}
+
+// GetIPDetailsBatch gets the lookup details of many IPs at once, reporting an error for each
+// IP that is invalid or has no results instead of failing the whole request
+func (r *queryResolver) GetIPDetailsBatch(ctx context.Context, ips []string) ([]*model.IPDetails, error) {
+	log.Printf("Query.GetIPDetailsBatch invoked for %d IP(s)", len(ips))
+
+	// Validate IP inputs, keeping the position of each
+	details := []*model.IPDetails{}
+	validIPs := []net.IP{}
+	for _, ip := range ips {
+		entry := &model.IPDetails{IP: ip}
+		details = append(details, entry)
+
+		validIp := net.ParseIP(ip)
+		if validIp == nil {
+			setDetailsError(entry, model.ErrorInvalidIPAddress)
+			continue
+		}
+		validIPs = append(validIPs, validIp)
+	}
+
+	// Retrieve the lookup results of every valid IP from the database at once
+	resultsByIP, err := r.Store.GetIPLookupResultsBatch(validIPs)
 	if err != nil {
-		log.Printf("error while retrieving lookup result: %s", err)
+		log.Printf("error while retrieving lookup results: %s", err)
 		return nil, err
 	}
 
-	return result, nil
+	for _, entry := range details {
+		if entry.Error != nil {
+			continue
+		}
+
+		results, ok := resultsByIP[net.ParseIP(entry.IP).String()]
+		if !ok {
+			setDetailsError(entry, db.ErrorNotFound)
+			continue
+		}
+		entry.Results = results
+	}
+
+	return details, nil
+}
+
+// ZoneHealth reports whether each configured zone is currently answering queries
+func (r *queryResolver) ZoneHealth(ctx context.Context) ([]*model.ZoneHealth, error) {
+	log.Printf("Query.ZoneHealth invoked")
+
+	health := r.Lookup.Health
+	if health == nil {
+		health = dns.NewHealthTracker(dns.DefaultHealthWindow)
+	}
+
+	return health.Status(r.Zones.Zones()), nil
+}
+
+// Job reports the progress of an enqueued job
+func (r *queryResolver) Job(ctx context.Context, id string) (*model.Job, error) {
+	log.Printf("Query.Job invoked for job: %s", id)
+
+	job, err := r.Store.GetJob(id)
+	if err != nil {
+		log.Printf("error while retrieving job: %s", err)
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// ListingEvents lists the IPs that were listed, delisted or had their listing changed since the given time
+func (r *queryResolver) ListingEvents(ctx context.Context, since time.Time) ([]*model.ListingEvent, error) {
+	log.Printf("Query.ListingEvents invoked since: %s", since)
+
+	events, err := r.Store.GetListingEvents(since)
+	if err != nil {
+		log.Printf("error while retrieving listing events: %s", err)
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// LookupResults pages through every stored lookup result matching the filter
+func (r *queryResolver) LookupResults(ctx context.Context, first *int, after *string, filter *model.LookupResultFilter) (*model.LookupResultConnection, error) {
+	log.Printf("Query.LookupResults invoked")
+
+	pageSize := db.DefaultPageSize
+	if first != nil {
+		pageSize = *first
+	}
+
+	results, err := r.Store.GetLookupResults(pageSize, after, filter)
+	if err != nil {
+		log.Printf("error while retrieving lookup results: %s", err)
+		return nil, err
+	}
+
+	return results, nil
 }
 
+// ResultsInNetwork gets every stored lookup result of the IPs inside a network, along with a summary
+func (r *queryResolver) ResultsInNetwork(ctx context.Context, cidr string) (*model.NetworkResults, error) {
+	log.Printf("Query.ResultsInNetwork invoked for network: %s", cidr)
+
+	results, err := r.Store.GetNetworkResults(cidr, r.MaxNetworkRangeBits)
+	if err != nil {
+		log.Printf("error while retrieving lookup results: %s", err)
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// LookupCompleted streams lookup results as they are stored, optionally only those of a job or of the given IPs
+func (r *subscriptionResolver) LookupCompleted(ctx context.Context, jobID *string, ips []net.IP) (<-chan *model.IPLookupResult, error) {
+	log.Printf("Subscription.LookupCompleted invoked")
+
+	// Only results of the job if one is given
+	subscribedJob := ""
+	if jobID != nil {
+		_, err := r.Store.GetJob(*jobID)
+		if err != nil {
+			log.Printf("error while retrieving job: %s", err)
+			return nil, err
+		}
+		subscribedJob = *jobID
+	}
+
+	return r.Lookup.Broker.Subscribe(ctx, subscribedJob, ips), nil
+}
+
+// IPLookupResult returns generated.IPLookupResultResolver implementation.
+func (r *Resolver) IPLookupResult() generated.IPLookupResultResolver {
+	return &iPLookupResultResolver{r}
+}
+
+// Job returns generated.JobResolver implementation.
+func (r *Resolver) Job() generated.JobResolver { return &jobResolver{r} }
+
 // Mutation returns generated.MutationResolver implementation.
 func (r *Resolver) Mutation() generated.MutationResolver { return &mutationResolver{r} }
 
 // Query returns generated.QueryResolver implementation.
 func (r *Resolver) Query() generated.QueryResolver { return &queryResolver{r} }
 
+// Subscription returns generated.SubscriptionResolver implementation.
+func (r *Resolver) Subscription() generated.SubscriptionResolver { return &subscriptionResolver{r} }
+
+type iPLookupResultResolver struct{ *Resolver }
+type jobResolver struct{ *Resolver }
 type mutationResolver struct{ *Resolver }
 type queryResolver struct{ *Resolver }
+type subscriptionResolver struct{ *Resolver }
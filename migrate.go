@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/grantsavage/ip-lookup-api/db"
+)
+
+// Error definitions
+var errorUnknownMigrateCommand = errors.New("unknown migrate command, expected up or status")
+
+// runMigrate applies pending migrations to the database with `migrate up`, which is the default,
+// or lists the state of each migration with `migrate status`
+func runMigrate(database db.Store, args []string, out io.Writer) error {
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := database.Migrate()
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "applied %d migration(s)\n", applied)
+	case "status":
+		states, err := database.Migrations()
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			status := "pending"
+			if state.AppliedAt != nil {
+				status = "applied at " + state.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", state.Version, state.Name, status)
+		}
+	default:
+		return errorUnknownMigrateCommand
+	}
+
+	return nil
+}
@@ -3,14 +3,17 @@ package main
 import (
 	"context"
 	"errors"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql/handler"
 	"github.com/go-chi/chi"
 	"github.com/grantsavage/ip-lookup-api/auth"
 	"github.com/grantsavage/ip-lookup-api/db"
+	"github.com/grantsavage/ip-lookup-api/dns"
 	"github.com/grantsavage/ip-lookup-api/graph"
 	"github.com/grantsavage/ip-lookup-api/graph/generated"
 )
@@ -18,25 +21,134 @@ import (
 // defaultPort is the default port to bind the server to
 const defaultPort = "8080"
 
-// main sets up the database and starts the GraphQL server
+// defaultDatabaseURL is the default SQLite database file
+const defaultDatabaseURL = "./database.db"
+
+// Default lookup timeouts
+const defaultQueryTimeout = 5 * time.Second
+const defaultJobTimeout = 10 * time.Minute
+
+// Default worker pool sizes
+const defaultWorkerCount = 8
+const defaultQueueSize = 10000
+
+// Default re-check schedule of stored results
+const defaultRecheckInterval = time.Hour
+const defaultListedTTL = 24 * time.Hour
+const defaultCleanTTL = 7 * 24 * time.Hour
+
+// Default retention policy and purge schedule of stored data
+const defaultListedRetention = 365 * 24 * time.Hour
+const defaultCleanRetention = 30 * 24 * time.Hour
+const defaultHistoryRetention = 90 * 24 * time.Hour
+const defaultEventRetention = 365 * 24 * time.Hour
+const defaultJobRetention = 30 * 24 * time.Hour
+const defaultPurgeInterval = time.Hour
+
+// defaultMaxRangeBits limits enqueued CIDR ranges to 1024 addresses, i.e. an IPv4 /22
+const defaultMaxRangeBits = 10
+
+// defaultMaxNetworkRangeBits limits resultsInNetwork to networks of up to 65536 addresses, i.e. an IPv4 /16
+const defaultMaxNetworkRangeBits = 16
+
+// defaultMaxEnqueueAddresses limits the IPs added by a single enqueue request
+const defaultMaxEnqueueAddresses = 10000
+
+// main sets up the database and starts the GraphQL server, unless a command is given
 func main() {
+	// Only manage the schema of the database when running the migrate command
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		database := openDatabase()
+		defer database.Close()
+
+		err := runMigrate(database, os.Args[2:], os.Stdout)
+		if err != nil {
+			log.Fatal("error running migrate command: ", err.Error())
+		}
+		return
+	}
+
 	// Get and setup app configuration
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = defaultPort
+	port := envString("PORT", defaultPort)
+	resolvers := dns.ParseResolverAddresses(os.Getenv("DNS_RESOLVERS"))
+	lookupConfig := dns.LookupConfig{
+		LookupFunc:   dns.ResolverLookupFunc(resolvers),
+		QueryTimeout: envDuration("DNS_QUERY_TIMEOUT", defaultQueryTimeout),
+		JobTimeout:   envDuration("DNS_JOB_TIMEOUT", defaultJobTimeout),
+		Health:       dns.NewHealthTracker(envDuration("ZONE_HEALTH_WINDOW", dns.DefaultHealthWindow)),
+		Broker:       dns.NewResultBroker(),
 	}
 
-	// Open connection to the database
-	database, err := db.Connect("./database.db")
+	// Fetch listing reasons from TXT records unless disabled
+	if envBool("DNS_FETCH_TXT", true) {
+		lookupConfig.TXTLookupFunc = dns.ResolverTXTLookupFunc(resolvers)
+	}
+
+	// Limit the number of IPs a single enqueue request adds
+	maxRangeBits := envInt("ENQUEUE_MAX_RANGE_BITS", defaultMaxRangeBits)
+	if maxRangeBits > dns.MaxRangeBitsLimit {
+		log.Fatalf("invalid ENQUEUE_MAX_RANGE_BITS %d, must be at most %d", maxRangeBits, dns.MaxRangeBitsLimit)
+	}
+	maxEnqueueAddresses := envInt("ENQUEUE_MAX_ADDRESSES", defaultMaxEnqueueAddresses)
+
+	// Load the blocklist zones to check IPs against
+	zones, err := dns.LoadRegistry(os.Getenv("DNSBL_ZONES_FILE"))
 	if err != nil {
-		log.Fatal("error connecting to the database", err.Error())
+		log.Fatal("error loading blocklist zones", err.Error())
 	}
+
+	// Open connection to the database
+	database := openDatabase()
 	defer database.Close()
 
-	// Setup the database
-	err = db.SetupDatabase(database)
+	// Bring the schema of the database up to date
+	applied, err := database.Migrate()
+	if err != nil {
+		log.Fatal("error migrating the database", err.Error())
+	}
+	log.Printf("applied %d database migration(s)", applied)
+
+	// Start the workers that look up enqueued IPs
+	pool := dns.NewPool(
+		database,
+		lookupConfig,
+		zones.Enabled(),
+		envInt("WORKER_COUNT", defaultWorkerCount),
+		envInt("QUEUE_SIZE", defaultQueueSize),
+	)
+	err = pool.Start(context.Background())
 	if err != nil {
-		log.Fatal("error setting up the database", err.Error())
+		log.Fatal("error starting the worker pool", err.Error())
+	}
+
+	// Periodically re-check IPs with stale results unless disabled
+	recheckInterval := envDuration("RECHECK_INTERVAL", defaultRecheckInterval)
+	if recheckInterval > 0 {
+		scheduler := dns.NewScheduler(
+			database,
+			pool,
+			envDuration("RECHECK_LISTED_TTL", defaultListedTTL),
+			envDuration("RECHECK_CLEAN_TTL", defaultCleanTTL),
+			recheckInterval,
+		)
+		scheduler.Start(context.Background())
+	}
+
+	// Delete data that is older than the retention policy, periodically unless disabled
+	purgeInterval := envDuration("PURGE_INTERVAL", defaultPurgeInterval)
+	purger := db.NewPurger(
+		database,
+		db.RetentionPolicy{
+			ListedResults: envDuration("RETENTION_LISTED_RESULTS", defaultListedRetention),
+			CleanResults:  envDuration("RETENTION_CLEAN_RESULTS", defaultCleanRetention),
+			History:       envDuration("RETENTION_HISTORY", defaultHistoryRetention),
+			Events:        envDuration("RETENTION_EVENTS", defaultEventRetention),
+			Jobs:          envDuration("RETENTION_JOBS", defaultJobRetention),
+		},
+		purgeInterval,
+	)
+	if purgeInterval > 0 {
+		purger.Start(context.Background())
 	}
 
 	// Setup router and middleware
@@ -46,7 +158,14 @@ func main() {
 	// Create and setup new GraphQL server
 	config := generated.Config{
 		Resolvers: &graph.Resolver{
-			Database: database,
+			Store:               database,
+			Zones:               zones,
+			Lookup:              lookupConfig,
+			Pool:                pool,
+			Purger:              purger,
+			MaxRangeBits:        maxRangeBits,
+			MaxEnqueueAddresses: maxEnqueueAddresses,
+			MaxNetworkRangeBits: envInt("NETWORK_MAX_RANGE_BITS", defaultMaxNetworkRangeBits),
 		},
 	}
 	server := handler.NewDefaultServer(generated.NewExecutableSchema(config))
@@ -57,10 +176,25 @@ func main() {
 		return errors.New("internal server error")
 	})
 
+	// Add error codes to errors and hide internal errors from clients
+	server.SetErrorPresenter(graph.ErrorPresenter)
+
 	// Bind GraphQL server to /graphql route
 	router.Handle("/graphql", server)
 
+	// Publish metrics, such as the number of purged rows
+	router.Handle("/debug/vars", expvar.Handler())
+
 	// Start listening for requests
 	log.Printf("started GraphQL server at http://localhost:%s/graphql", port)
 	log.Fatal(http.ListenAndServe(":"+port, router))
 }
+
+// openDatabase opens the configured database
+func openDatabase() db.Store {
+	database, err := db.Open(envString("DATABASE_DRIVER", db.DriverSQLite), envString("DATABASE_URL", defaultDatabaseURL))
+	if err != nil {
+		log.Fatal("error connecting to the database", err.Error())
+	}
+	return database
+}